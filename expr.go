@@ -0,0 +1,849 @@
+package bqb
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// CaseExpr builds a searched `CASE WHEN ... THEN ... ELSE ... END`
+// expression. Use NewCase to create one.
+type CaseExpr struct {
+	whens   []*Query
+	elseVal any
+	hasElse bool
+}
+
+// NewCase returns an empty CaseExpr.
+func NewCase() *CaseExpr {
+	return &CaseExpr{}
+}
+
+// When adds a `WHEN cond THEN then` branch. A string cond is used as a sql
+// fragment and a *Query cond is inlined with its parameters. The `then`
+// value is bound as a parameter unless it's a *Query.
+func (c *CaseExpr) When(cond, then any) *CaseExpr {
+	c.whens = append(c.whens, New("WHEN ? THEN ?", fragmentArgs([]any{cond})[0], then))
+	return c
+}
+
+// Else sets the `ELSE` value, which is bound like the values passed to When.
+func (c *CaseExpr) Else(value any) *CaseExpr {
+	c.elseVal = value
+	c.hasElse = true
+	return c
+}
+
+// Build returns the CASE expression as a Query.
+func (c *CaseExpr) Build() *Query {
+	q := New("CASE")
+	if len(c.whens) == 0 {
+		q.addErr(errors.New("CASE requires at least one WHEN"))
+	}
+	for _, when := range c.whens {
+		q.Space("?", when)
+	}
+	if c.hasElse {
+		q.Space("ELSE ?", c.elseVal)
+	}
+	return q.Space("END")
+}
+
+// WindowExpr builds a window function call, `fn OVER (PARTITION BY ...
+// ORDER BY ...)`. Use Over to create one.
+type WindowExpr struct {
+	fn         any
+	partitions []string
+	orders     *Query
+}
+
+// Over returns a WindowExpr for fn, e.g. Over("ROW_NUMBER()"). A string fn
+// is used as a sql fragment and a *Query fn is inlined with its parameters.
+func Over(fn any) *WindowExpr {
+	return &WindowExpr{fn: fn}
+}
+
+// PartitionBy adds cols to the `PARTITION BY` list of the window.
+func (w *WindowExpr) PartitionBy(cols ...string) *WindowExpr {
+	w.partitions = append(w.partitions, cols...)
+	return w
+}
+
+// OrderBy adds expr to the `ORDER BY` list of the window. A string expr is
+// used as a sql fragment and a *Query expr is inlined with its parameters.
+func (w *WindowExpr) OrderBy(expr any, dir Direction) *WindowExpr {
+	if dir != ASC && dir != DESC {
+		w.orders = w.orders.addErr(fmt.Errorf("invalid order direction: %v", dir))
+		return w
+	}
+	w.orders = w.orders.Join(", ", "? "+string(dir), fragmentArgs([]any{expr})...)
+	return w
+}
+
+// Build returns the windowed expression as a Query.
+func (w *WindowExpr) Build() *Query {
+	window := Q()
+	if len(w.partitions) > 0 {
+		window.Space("PARTITION BY " + strings.Join(w.partitions, ", "))
+	}
+	if w.orders != nil {
+		window.Space("ORDER BY ?", w.orders)
+	}
+	return New("? OVER (?)", append(fragmentArgs([]any{w.fn}), window)...)
+}
+
+// TupleExpr builds row value comparisons on a list of columns, such as
+// `(a,b) IN ((?,?),(?,?))`. Use Tuple to create one.
+type TupleExpr struct {
+	cols []string
+}
+
+// Tuple returns a TupleExpr for cols.
+func Tuple(cols ...string) *TupleExpr {
+	return &TupleExpr{cols: cols}
+}
+
+// Eq returns a `(a,b) = (?,?)` query with values bound in order. There must
+// be one value for each column.
+func (t *TupleExpr) Eq(values ...any) *Query {
+	return t.compare("=", [][]any{values})
+}
+
+// In returns a `(a,b) IN ((?,?),(?,?))` query with the values bound row by
+// row. Every row must have one value for each column. When there are no
+// rows the query resolves to `1=0`, like In.
+func (t *TupleExpr) In(rows [][]any) *Query {
+	if len(rows) == 0 {
+		return New("1=0")
+	}
+	return t.compare("IN", rows)
+}
+
+func (t *TupleExpr) compare(op string, rows [][]any) *Query {
+	for i, row := range rows {
+		if len(row) != len(t.cols) {
+			return Q().addErr(fmt.Errorf("row %d has %d values, expected %d", i, len(row), len(t.cols)))
+		}
+	}
+	values := Values(rows)
+	if op == "IN" {
+		values = New("(?)", values)
+	}
+	return New("("+strings.Join(t.cols, ",")+") "+op+" ?", values)
+}
+
+// All returns a postgres `column op ALL(?)` query, e.g. `price > ALL($1)`.
+// See Any.
+func All(dialect Dialect, column, op string, arr any) *Query {
+	return arrayOp(dialect, column, op, "ALL", arr)
+}
+
+// AllOf returns the conds joined with AND and wrapped in parentheses, e.g.
+// `(a = ? AND b > ?)`, so the group can be combined with other conditions
+// safely. Nil and empty conds are skipped, as are AllOf and AnyOf groups
+// without conds, and when none are left the query resolves to `1=1`.
+func AllOf(conds ...*Query) *Query {
+	return group("AND", "1=1", conds)
+}
+
+// Any returns a postgres `column op ANY(?)` query, e.g. `id = ANY($1)`. The
+// arr value is bound as a single array parameter rather than being expanded
+// like other slices, so it may need wrapping for the driver, e.g. with
+// pq.Array. Any other dialect results in an error when the query is built.
+func Any(dialect Dialect, column, op string, arr any) *Query {
+	return arrayOp(dialect, column, op, "ANY", arr)
+}
+
+// AnyOf returns the conds joined with OR and wrapped in parentheses, e.g.
+// `(a = ? OR b > ?)`. Conds are skipped as in AllOf, and when none are left
+// the query resolves to `1=0`.
+func AnyOf(conds ...*Query) *Query {
+	return group("OR", "1=0", conds)
+}
+
+// Assignments returns the `"a" = ?,"b" = ?` list of an UPDATE's SET clause
+// for the columns and values in m. Columns are sorted so the output is the
+// same on every build, and are quoted as an Identifier, so they must be
+// plain or qualified names, and the query must be built for a specific
+// dialect rather than with ToSql or ToRaw.
+func Assignments(m map[string]any) *Query {
+	if len(m) == 0 {
+		return Q().addErr(errors.New("cannot use Assignments without values"))
+	}
+	cols := make([]string, 0, len(m))
+	for col := range m {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+
+	q := Q()
+	for _, col := range cols {
+		q.Comma("? = ?", Identifier(col), m[col])
+	}
+	return q
+}
+
+// Avg returns an `AVG(expr)` query. See Count.
+func Avg(expr any) *Query {
+	return aggregate("AVG", expr)
+}
+
+// Between returns a `column BETWEEN ? AND ?` query. Bounds that are a
+// *Query are inlined rather than bound.
+func Between(column string, low, high any) *Query {
+	return New(column+" BETWEEN ? AND ?", low, high)
+}
+
+// Cast returns a portable `CAST(expr AS typ)` query. A string expr is used
+// as a sql fragment such as a column name, a *Query is inlined, and any other
+// value is bound as a parameter. Use New("?", "text") to cast a bound string.
+func Cast(expr any, typ string) *Query {
+	return New("CAST(? AS "+typ+")", fragmentArgs([]any{expr})...)
+}
+
+// Coalesce returns a `COALESCE(...)` query. Plain strings are treated as sql
+// fragments such as column names, *Query values are inlined, and any other
+// value is bound as a parameter. Use New("?", "text") to bind a string.
+func Coalesce(args ...any) *Query {
+	return variadic("COALESCE", args)
+}
+
+// Col returns a bare column reference, for comparing one column with another
+// rather than with a bound value, e.g. Eq("a.id", Col("b.user_id")) gives
+// `a.id = b.user_id`. Like Identifier, only letters, digits and underscores
+// are allowed, with `.` between the parts of a qualified name. Use
+// Identifier instead to have the name quoted for the dialect.
+func Col(name string) *Query {
+	if !identRegexp.MatchString(name) {
+		return Q().addErr(fmt.Errorf("invalid column: %q", name))
+	}
+	return New(name)
+}
+
+// Concat returns the string concatenation of args, `a || ? || ?`, or
+// `CONCAT(a,?,?)` when built for MySQL or SQL Server. A *Query is inlined
+// with its parameters and any other value, including a string, is bound as
+// a parameter, so use Col for a column, e.g. Concat(Col("name"), "!").
+func Concat(args ...any) *Query {
+	if len(args) == 0 {
+		return Q().addErr(errors.New("cannot use Concat without args"))
+	}
+	// The parts are joined here since text passed to New can't hold the
+	// placeholders that are replaced with the dialect's syntax
+	var texts []string
+	joined := QueryPart{}
+	for _, arg := range args {
+		part := makePart("?", arg)
+		texts = append(texts, part.Text)
+		joined.Params = append(joined.Params, part.Params...)
+		joined.Errs = append(joined.Errs, part.Errs...)
+	}
+	joined.Text = fmt.Sprintf(concatPh, "START") +
+		strings.Join(texts, fmt.Sprintf(concatPh, "SEP")) +
+		fmt.Sprintf(concatPh, "END")
+	q := Q()
+	q.Parts = append(q.Parts, joined)
+	return q
+}
+
+// Count returns a `COUNT(expr)` query. A string expr, including "*", is used
+// as a sql fragment such as a column name, a *Query is inlined with its
+// parameters, and any other value is bound as a parameter.
+func Count(expr any) *Query {
+	return aggregate("COUNT", expr)
+}
+
+// CountDistinct returns a `COUNT(DISTINCT expr)` query. See Count.
+func CountDistinct(expr any) *Query {
+	return New("COUNT(DISTINCT ?)", fragmentArgs([]any{expr})...)
+}
+
+// DateAdd returns a query adding n units to the date or time expr. A string
+// expr is used as a sql fragment, e.g. "now()" or a column name, and a *Query
+// is inlined with its parameters. The form depends on dialect:
+//
+//	PGSQL:  expr + interval '7 day'
+//	MYSQL:  DATE_ADD(expr, INTERVAL 7 DAY)
+//	SQLITE: datetime(expr, '+7 days')
+//	MSSQL:  DATEADD(day, 7, expr)
+//
+// Any other dialect results in an error when the query is built.
+func DateAdd(dialect Dialect, expr any, n int, unit IntervalUnit) *Query {
+	return dateMath(dialect, expr, n, unit, false)
+}
+
+// DateSub returns a query subtracting n units from the date or time expr,
+// e.g. `now() - interval '7 day'` or `DATE_SUB(NOW(), INTERVAL 7 DAY)`.
+// See DateAdd.
+func DateSub(dialect Dialect, expr any, n int, unit IntervalUnit) *Query {
+	return dateMath(dialect, expr, n, unit, true)
+}
+
+// Eq returns a `column = ?` query. The value is bound as a parameter unless
+// it's a *Query, such as a subquery or Col("other.column"), which is
+// inlined. A nil value, including a nil pointer, gives `column IS NULL`.
+func Eq(column string, value any) *Query {
+	if value == nil || isNilPointer(value) {
+		return IsNull(column)
+	}
+	return compare(column, "=", value)
+}
+
+// Except returns the first query minus the rows of the others, using EXCEPT
+// (MINUS for Oracle). It's not supported by MySQL. See Union.
+func Except(dialect Dialect, queries ...*Query) *Query {
+	return combine(dialect, "EXCEPT", queries)
+}
+
+// Exists returns an `EXISTS (subquery)` query.
+func Exists(subquery *Query) *Query {
+	return exists("EXISTS", subquery)
+}
+
+// Greatest returns a `GREATEST(...)` query of the largest of args. sqlite has
+// no GREATEST, so its multi-argument `MAX(...)` is used instead. Args are
+// handled as in Coalesce.
+func Greatest(dialect Dialect, args ...any) *Query {
+	if dialect == SQLITE {
+		return variadic("MAX", args)
+	}
+	return variadic("GREATEST", args)
+}
+
+// Gt returns a `column > ?` query. See Eq.
+func Gt(column string, value any) *Query {
+	return compare(column, ">", value)
+}
+
+// Gte returns a `column >= ?` query. See Eq.
+func Gte(column string, value any) *Query {
+	return compare(column, ">=", value)
+}
+
+// Ident quotes each of parts as an identifier for dialect and joins them
+// with `.`, e.g. Ident(PGSQL, "public", "user") returns "public"."user".
+// MySQL and BigQuery use backticks, SQL Server uses brackets, and other
+// dialects use double quotes. Embedded quote characters are escaped by
+// doubling them.
+func Ident(dialect Dialect, parts ...string) string {
+	left, right := `"`, `"`
+	switch dialect {
+	case MYSQL, BIGQUERY:
+		left, right = "`", "`"
+	case MSSQL:
+		left, right = "[", "]"
+	}
+
+	quoted := make([]string, len(parts))
+	for i, part := range parts {
+		quoted[i] = left + strings.ReplaceAll(part, right, right+right) + right
+	}
+	return strings.Join(quoted, ".")
+}
+
+// ILike returns a case insensitive `column ILIKE ?` query for postgres.
+// Dialects without ILIKE get `LOWER(column) LIKE LOWER(?)` instead.
+func ILike(dialect Dialect, column string, pattern any) *Query {
+	switch dialect {
+	case PGSQL, COCKROACH:
+		return New(column+" ILIKE ?", pattern)
+	default:
+		return New("LOWER("+column+") LIKE LOWER(?)", pattern)
+	}
+}
+
+// ILikeAny is the case insensitive form of LikeAny, using ILIKE for
+// postgres and ILike's LOWER() form for other dialects.
+func ILikeAny(dialect Dialect, column string, patterns []string) *Query {
+	if dialect == PGSQL || dialect == COCKROACH {
+		return likeAny(column, "ILIKE", patterns)
+	}
+	return orAll(len(patterns), func(i int) *Query { return ILike(dialect, column, patterns[i]) })
+}
+
+// In returns a `column IN (?,...)` query with each value bound as a
+// parameter. A single slice value is expanded into its elements. When there
+// are no values the query resolves to `1=0`, as an empty IN list is invalid.
+func In(column string, values ...any) *Query {
+	return in(column, "IN", "1=0", values)
+}
+
+// InChunked is like In, but splits values into IN lists of at most
+// chunkSize values joined with OR, `(column IN (...) OR column IN (...))`,
+// e.g. for Oracle's limit of 1000 values per list. A chunkSize of 0 means
+// no chunking.
+func InChunked(column string, values []any, chunkSize int) *Query {
+	if chunkSize < 0 {
+		return Q().addErr(fmt.Errorf("invalid negative chunk size: %d", chunkSize))
+	}
+	values = flattenArgs(values)
+	if chunkSize == 0 || len(values) <= chunkSize {
+		return in(column, "IN", "1=0", values)
+	}
+
+	chunks := Q()
+	for start := 0; start < len(values); start += chunkSize {
+		end := start + chunkSize
+		if end > len(values) {
+			end = len(values)
+		}
+		chunks.Or(column+" IN ("+placeholders(end-start)+")", values[start:end]...)
+	}
+	return New("(?)", chunks)
+}
+
+// InsertSelect returns an `INSERT INTO table (cols) SELECT ...` query that
+// inserts the rows of src, with the parameters of src kept in order. bqb
+// doesn't parse sql, so the number of cols isn't checked against the
+// columns selected by src.
+func InsertSelect(table string, cols []string, src *Query) *Query {
+	if src == nil {
+		return Q().addErr(errors.New("cannot use nil Query with InsertSelect"))
+	}
+	if len(cols) == 0 {
+		return New("INSERT INTO "+table+" ?", src)
+	}
+	return New("INSERT INTO "+table+" ("+strings.Join(cols, ",")+") ?", src)
+}
+
+// NotExists is the negated form of Exists.
+func NotExists(subquery *Query) *Query {
+	return exists("NOT EXISTS", subquery)
+}
+
+// NotIn is the negated form of In. When there are no values the query
+// resolves to `1=1`.
+func NotIn(column string, values ...any) *Query {
+	return in(column, "NOT IN", "1=1", values)
+}
+
+// Intersect returns the rows common to all of the queries. It's not
+// supported by MySQL. See Union.
+func Intersect(dialect Dialect, queries ...*Query) *Query {
+	return combine(dialect, "INTERSECT", queries)
+}
+
+// Interval returns an interval of n units, `interval '7 day'` for postgres
+// or `INTERVAL 7 DAY` for MySQL. Other dialects have no interval value, so
+// DateAdd and DateSub should be used instead.
+func Interval(dialect Dialect, n int, unit IntervalUnit) *Query {
+	if !validUnit(unit) {
+		return Q().addErr(fmt.Errorf("invalid interval unit: %v", unit))
+	}
+	switch dialect {
+	case PGSQL, COCKROACH:
+		return New(fmt.Sprintf("interval '%d %s'", n, strings.ToLower(string(unit))))
+	case MYSQL:
+		return New(fmt.Sprintf("INTERVAL %d %s", n, unit))
+	default:
+		return Q().addErr(fmt.Errorf("Interval is not supported by %v", dialect))
+	}
+}
+
+// IsNotNull returns a `column IS NOT NULL` query.
+func IsNotNull(column string) *Query {
+	return New(column + " IS NOT NULL")
+}
+
+// IsNull returns a `column IS NULL` query.
+func IsNull(column string) *Query {
+	return New(column + " IS NULL")
+}
+
+// JsonExtract returns a query extracting the text value at path from the
+// json in column. The path is a dotted list of object keys, e.g. "a.b",
+// which is translated to the syntax of dialect:
+//
+//	PGSQL:         column #>> '{a,b}' (column->>'a' for a single key)
+//	MYSQL:         JSON_UNQUOTE(JSON_EXTRACT(column, '$.a.b'))
+//	SQLITE:        json_extract(column, '$.a.b')
+//	MSSQL, ORACLE: JSON_VALUE(column, '$.a.b')
+//
+// Any other dialect results in an error when the query is built.
+func JsonExtract(dialect Dialect, column, path string) *Query {
+	keys := strings.Split(path, ".")
+	for _, key := range keys {
+		if key == "" || strings.Contains(key, "?") {
+			return Q().addErr(fmt.Errorf("invalid json path: %q", path))
+		}
+	}
+
+	switch dialect {
+	case PGSQL, COCKROACH:
+		if len(keys) == 1 {
+			return New(column + "->>" + quoteString(keys[0]))
+		}
+		for i, key := range keys {
+			if strings.ContainsAny(key, `,{}" \`) {
+				keys[i] = jsonQuoteKey(key)
+			}
+		}
+		return New(column + " #>> " + quoteString("{"+strings.Join(keys, ",")+"}"))
+	case MYSQL:
+		return New("JSON_UNQUOTE(JSON_EXTRACT(" + column + ", " + jsonPath(keys) + "))")
+	case SQLITE:
+		return New("json_extract(" + column + ", " + jsonPath(keys) + ")")
+	case MSSQL, ORACLE:
+		return New("JSON_VALUE(" + column + ", " + jsonPath(keys) + ")")
+	default:
+		return Q().addErr(fmt.Errorf("JsonExtract is not supported by %v", dialect))
+	}
+}
+
+// Least returns a `LEAST(...)` query of the smallest of args, using `MIN(...)`
+// for sqlite. See Greatest.
+func Least(dialect Dialect, args ...any) *Query {
+	if dialect == SQLITE {
+		return variadic("MIN", args)
+	}
+	return variadic("LEAST", args)
+}
+
+// Like returns a `column LIKE ?` query with the pattern bound as a parameter.
+func Like(column string, pattern any) *Query {
+	return New(column+" LIKE ?", pattern)
+}
+
+// LikeAny returns a query matching column against any of patterns. Postgres
+// gets `column LIKE ANY(?)` with the patterns bound as a single array
+// parameter, see Any. Other dialects get `(column LIKE ? OR column LIKE ?)`.
+// When there are no patterns the query resolves to `1=0`.
+func LikeAny(dialect Dialect, column string, patterns []string) *Query {
+	if dialect == PGSQL || dialect == COCKROACH {
+		return likeAny(column, "LIKE", patterns)
+	}
+	return orAll(len(patterns), func(i int) *Query { return Like(column, patterns[i]) })
+}
+
+// Lt returns a `column < ?` query. See Eq.
+func Lt(column string, value any) *Query {
+	return compare(column, "<", value)
+}
+
+// Lte returns a `column <= ?` query. See Eq.
+func Lte(column string, value any) *Query {
+	return compare(column, "<=", value)
+}
+
+// Max returns a `MAX(expr)` query. See Count.
+func Max(expr any) *Query {
+	return aggregate("MAX", expr)
+}
+
+// Min returns a `MIN(expr)` query. See Count.
+func Min(expr any) *Query {
+	return aggregate("MIN", expr)
+}
+
+// Neq returns a `column <> ?` query. A nil value gives `column IS NOT NULL`.
+// See Eq.
+func Neq(column string, value any) *Query {
+	if value == nil || isNilPointer(value) {
+		return IsNotNull(column)
+	}
+	return compare(column, "<>", value)
+}
+
+// Not returns a `NOT (expr)` query. A string expr is used as a sql fragment
+// and a *Query expr is inlined with its parameters.
+func Not(expr any) *Query {
+	return New("NOT (?)", fragmentArgs([]any{expr})...)
+}
+
+// NotBetween is the negated form of Between.
+func NotBetween(column string, low, high any) *Query {
+	return New(column+" NOT BETWEEN ? AND ?", low, high)
+}
+
+// NotLike is the negated form of Like.
+func NotLike(column string, pattern any) *Query {
+	return New(column+" NOT LIKE ?", pattern)
+}
+
+// Nullif returns a `NULLIF(a, b)` query, e.g. for a divide by zero guard
+// like New("total / ?", Nullif("count", 0)). Args are handled as in Coalesce.
+func Nullif(a, b any) *Query {
+	return variadic("NULLIF", []any{a, b})
+}
+
+// Set returns an Assignment of value to column. The value is bound as a
+// parameter unless it's a *Query, e.g. New("EXCLUDED.name"), which is inlined.
+func Set(column string, value any) Assignment {
+	return Assignment{Column: column, Value: value}
+}
+
+// Sum returns a `SUM(expr)` query. See Count.
+func Sum(expr any) *Query {
+	return aggregate("SUM", expr)
+}
+
+// Union returns the queries combined with UNION. Each query is wrapped in
+// parentheses, except for sqlite which doesn't allow them, so an ORDER BY or
+// Limit added to the result applies to the whole union.
+func Union(dialect Dialect, queries ...*Query) *Query {
+	return combine(dialect, "UNION", queries)
+}
+
+// UnionAll is like Union but keeps duplicate rows.
+func UnionAll(dialect Dialect, queries ...*Query) *Query {
+	return combine(dialect, "UNION ALL", queries)
+}
+
+// Values returns the `(?,?),(?,?)` tuple list of a multi-row INSERT, with
+// the values bound in row order. Every row must have the same number of
+// values.
+func Values(rows [][]any) *Query {
+	if len(rows) == 0 {
+		return Q().addErr(errors.New("cannot use Values without rows"))
+	}
+
+	tuple := "(" + placeholders(len(rows[0])) + ")"
+	q := Q()
+	for i, row := range rows {
+		if len(row) != len(rows[0]) {
+			q.addErr(fmt.Errorf("row %d has %d values, expected %d", i, len(row), len(rows[0])))
+			continue
+		}
+		q.Comma(tuple, row...)
+	}
+	return q
+}
+
+// aggregate returns the `fn(expr)` query of an aggregate function.
+func aggregate(fn string, expr any) *Query {
+	return New(fn+"(?)", fragmentArgs([]any{expr})...)
+}
+
+// arrayOp builds the query for All and Any. The part is made directly so
+// that arr is bound as is instead of being expanded by convertArg.
+func arrayOp(dialect Dialect, column, op, fn string, arr any) *Query {
+	if dialect != PGSQL && dialect != COCKROACH {
+		return Q().addErr(fmt.Errorf("%v is not supported by %v", fn, dialect))
+	}
+	text := column + " " + op + " " + fn + "("
+	if err := checkReserved(text); err != nil {
+		return Q().addErr(err)
+	}
+	return &Query{Parts: []QueryPart{{Text: text + paramPh + ")", Params: []any{arr}}}}
+}
+
+// assignments returns the `a = ?,b = ?` list for set.
+func assignments(set []Assignment) *Query {
+	q := Q()
+	for _, a := range set {
+		q.Comma(a.Column+" = ?", a.Value)
+	}
+	return q
+}
+
+func combine(dialect Dialect, op string, queries []*Query) *Query {
+	switch {
+	case dialect == MYSQL && (op == "INTERSECT" || op == "EXCEPT"):
+		return Q().addErr(fmt.Errorf("%v is not supported by %v", op, dialect))
+	case dialect == ORACLE && op == "EXCEPT":
+		op = "MINUS"
+	}
+	if len(queries) < 2 {
+		return Q().addErr(fmt.Errorf("%v requires at least two queries", op))
+	}
+
+	wrap := "(?)"
+	if dialect == SQLITE {
+		wrap = "?"
+	}
+
+	q := Q()
+	for _, sub := range queries {
+		if sub == nil {
+			return Q().addErr(fmt.Errorf("cannot use nil Query with %v", op))
+		}
+		q.Join(" "+op+" ", wrap, sub)
+	}
+	return q
+}
+
+// compare returns the `column op ?` query of a comparison operator.
+func compare(column, op string, value any) *Query {
+	return New(column+" "+op+" ?", value)
+}
+
+// dateMath builds the query for DateAdd and DateSub.
+func dateMath(dialect Dialect, expr any, n int, unit IntervalUnit, sub bool) *Query {
+	if !validUnit(unit) {
+		return Q().addErr(fmt.Errorf("invalid interval unit: %v", unit))
+	}
+	args := fragmentArgs([]any{expr})
+	switch dialect {
+	case PGSQL, COCKROACH:
+		op := " + "
+		if sub {
+			op = " - "
+		}
+		return New("?"+op+"?", args[0], Interval(dialect, n, unit))
+	case MYSQL:
+		fn := "DATE_ADD"
+		if sub {
+			fn = "DATE_SUB"
+		}
+		return New(fn+"(?, ?)", args[0], Interval(dialect, n, unit))
+	case SQLITE:
+		// sqlite has no week modifier
+		if unit == WEEK {
+			n, unit = n*7, DAY
+		}
+		if sub {
+			n = -n
+		}
+		return New(fmt.Sprintf("datetime(?, '%+d %ss')", n, strings.ToLower(string(unit))), args...)
+	case MSSQL:
+		if sub {
+			n = -n
+		}
+		return New(fmt.Sprintf("DATEADD(%s, %d, ?)", strings.ToLower(string(unit)), n), args...)
+	default:
+		return Q().addErr(fmt.Errorf("date arithmetic is not supported by %v", dialect))
+	}
+}
+
+func exists(op string, subquery *Query) *Query {
+	if subquery == nil {
+		return Q().addErr(errors.New("cannot use nil Query with " + op))
+	}
+	return New(op+" (?)", subquery)
+}
+
+// group returns the non empty conds joined with op and wrapped in
+// parentheses, or none when there are no such conds. Groups without conds
+// are skipped, so only the outermost resolves to its none condition, and a
+// single group is returned as is rather than wrapped again.
+func group(op, none string, conds []*Query) *Query {
+	var parts []string
+	var args []any
+	for _, c := range conds {
+		if c == nil || c.Empty() || c.noConds {
+			continue
+		}
+		parts = append(parts, "?")
+		args = append(args, c)
+	}
+
+	var q *Query
+	switch {
+	case len(parts) == 0:
+		q = New(none)
+		q.noConds = true
+	case len(args) == 1 && args[0].(*Query).grouped:
+		q = args[0].(*Query).Clone()
+	default:
+		q = New("("+strings.Join(parts, " "+op+" ")+")", args...)
+	}
+	q.grouped = true
+	return q
+}
+
+func in(column, op, empty string, values []any) *Query {
+	values = flattenArgs(values)
+	if len(values) == 0 {
+		return New(empty)
+	}
+	return New(column+" "+op+" ("+placeholders(len(values))+")", values...)
+}
+
+// flattenArgs expands `args` into its elements when it holds a single
+// slice, excluding byte slices.
+func flattenArgs(args []any) []any {
+	if len(args) != 1 {
+		return args
+	}
+	rv := reflect.ValueOf(args[0])
+	if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return args
+	}
+	flat := make([]any, rv.Len())
+	for i := range flat {
+		flat[i] = rv.Index(i).Interface()
+	}
+	return flat
+}
+
+// fragmentArgs returns a copy of args with plain strings converted to
+// Embedded, so that they're used as sql fragments rather than bound.
+func fragmentArgs(args []any) []any {
+	converted := make([]any, len(args))
+	for i, arg := range args {
+		if s, ok := arg.(string); ok {
+			converted[i] = Embedded(s)
+		} else {
+			converted[i] = arg
+		}
+	}
+	return converted
+}
+
+// jsonPath returns the quoted `'$.a.b'` sql/json path for keys. Keys other
+// than plain identifiers are double quoted.
+func jsonPath(keys []string) string {
+	path := "$"
+	for _, key := range keys {
+		for i := 0; i < len(key); i++ {
+			if !isNameChar(key[i]) {
+				key = jsonQuoteKey(key)
+				break
+			}
+		}
+		path += "." + key
+	}
+	return quoteString(path)
+}
+
+// jsonQuoteKey double quotes key, escaping any `"` and `\` it contains.
+func jsonQuoteKey(key string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(key) + `"`
+}
+
+// likeAny returns the postgres `column op ANY(?)` query of LikeAny.
+func likeAny(column, op string, patterns []string) *Query {
+	if len(patterns) == 0 {
+		return New("1=0")
+	}
+	return arrayOp(PGSQL, column, op, "ANY", patterns)
+}
+
+// orAll returns the n queries returned by fn joined with OR and wrapped in
+// parentheses, or `1=0` when n is 0.
+func orAll(n int, fn func(i int) *Query) *Query {
+	if n == 0 {
+		return New("1=0")
+	}
+	if n == 1 {
+		return fn(0)
+	}
+	q := Q()
+	for i := 0; i < n; i++ {
+		q.Or("?", fn(i))
+	}
+	return New("(?)", q)
+}
+
+// placeholders returns `n` comma separated ? placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+// variadic returns the `fn(...)` query of a function taking any number of
+// args, with strings used as sql fragments.
+func variadic(fn string, args []any) *Query {
+	return New(fn+"("+placeholders(len(args))+")", fragmentArgs(args)...)
+}
+
+// validUnit returns true if unit is one of the IntervalUnit constants.
+func validUnit(unit IntervalUnit) bool {
+	switch unit {
+	case SECOND, MINUTE, HOUR, DAY, WEEK, MONTH, YEAR:
+		return true
+	default:
+		return false
+	}
+}
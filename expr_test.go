@@ -0,0 +1,983 @@
+package bqb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIn(t *testing.T) {
+	tests := []struct {
+		q         *Query
+		want      string
+		wantParam []any
+	}{
+		{In("id", 1, 2, 3), "id IN (?,?,?)", []any{1, 2, 3}},
+		{In("id", 1), "id IN (?)", []any{1}},
+		{In("id", []string{"a", "b"}), "id IN (?,?)", []any{"a", "b"}},
+		{In("id"), "1=0", nil},
+		{In("id", []int{}), "1=0", nil},
+		{NotIn("id", 1, 2), "id NOT IN (?,?)", []any{1, 2}},
+		{NotIn("id"), "1=1", nil},
+	}
+
+	for _, tt := range tests {
+		sql, params, err := tt.q.ToSql()
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		if sql != tt.want {
+			t.Errorf("got: %q, want: %q", sql, tt.want)
+		}
+		if !reflect.DeepEqual(params, tt.wantParam) {
+			t.Errorf("got: %v, want: %v", params, tt.wantParam)
+		}
+	}
+
+	sql, _, _ := New("SELECT * FROM t WHERE ?", In("id", 4, 5)).ToPgsql()
+	want := "SELECT * FROM t WHERE id IN ($1,$2)"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+}
+
+func TestBetween(t *testing.T) {
+	sql, params, err := Between("age", 18, 65).ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "age BETWEEN $1 AND $2"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{18, 65}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	low := New("(SELECT MIN(price) FROM items WHERE shop = ?)", "a")
+	sql, params, _ = NotBetween("price", low, 9.5).ToPgsql()
+	want = "price NOT BETWEEN (SELECT MIN(price) FROM items WHERE shop = $1) AND $2"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{"a", 9.5}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+}
+
+func TestLike(t *testing.T) {
+	tests := []struct {
+		q    *Query
+		want string
+	}{
+		{Like("name", "a%"), "name LIKE ?"},
+		{NotLike("name", "a%"), "name NOT LIKE ?"},
+		{ILike(PGSQL, "name", "a%"), "name ILIKE ?"},
+		{ILike(MYSQL, "name", "a%"), "LOWER(name) LIKE LOWER(?)"},
+	}
+
+	for _, tt := range tests {
+		sql, params, err := tt.q.ToSql()
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		if sql != tt.want {
+			t.Errorf("got: %q, want: %q", sql, tt.want)
+		}
+		if len(params) != 1 || params[0] != "a%" {
+			t.Errorf("got unexpected params: %v", params)
+		}
+	}
+}
+
+func TestIsNull(t *testing.T) {
+	q := Q().And("?", IsNull("a")).And("?", IsNotNull("b"))
+	sql, params, err := q.ToSql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+
+	want := "a IS NULL AND b IS NOT NULL"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if len(params) != 0 {
+		t.Errorf("expected no params, got: %v", params)
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	q := Coalesce("nickname", New("LOWER(?)", "Name"), 0)
+	sql, params, err := q.ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+
+	want := "COALESCE(nickname,LOWER($1),$2)"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{"Name", 0}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+}
+
+func TestCaseExpr(t *testing.T) {
+	q := NewCase().
+		When(New("x > ?", 0), "pos").
+		When("x = 0", New("UPPER(?)", "zero")).
+		Else("neg").
+		Build()
+
+	sql, params, err := q.ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+
+	want := "CASE WHEN x > $1 THEN $2 WHEN x = 0 THEN UPPER($3) ELSE $4 END"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{0, "pos", "zero", "neg"}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	sql, _, _ = NewCase().When("a", 1).Build().ToSql()
+	want = "CASE WHEN a THEN ? END"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	_, _, err = NewCase().Else(1).Build().ToSql()
+	if err == nil {
+		t.Errorf("expected error for CASE without WHEN")
+	}
+}
+
+func TestExists(t *testing.T) {
+	inner := New("SELECT 1 FROM orders WHERE orders.user_id = users.id AND total > ?", 100)
+
+	sql, params, err := New("SELECT * FROM users WHERE ? AND age > ?", Exists(inner), 21).ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "SELECT * FROM users WHERE EXISTS (SELECT 1 FROM orders WHERE orders.user_id = users.id AND total > $1) AND age > $2"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{100, 21}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	sql, _, _ = NotExists(New("SELECT 1")).ToSql()
+	want = "NOT EXISTS (SELECT 1)"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	_, _, err = New("WHERE ?", Exists(nil)).ToSql()
+	if err == nil {
+		t.Errorf("expected error for nil subquery")
+	}
+}
+
+func TestValues(t *testing.T) {
+	rows := [][]any{{1, "a"}, {2, "b"}, {3, "c"}}
+	q := New("INSERT INTO t (id,name) VALUES ?", Values(rows))
+
+	sql, params, err := q.ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "INSERT INTO t (id,name) VALUES ($1,$2),($3,$4),($5,$6)"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{1, "a", 2, "b", 3, "c"}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	_, _, err = Values([][]any{{1, "a"}, {2}}).ToSql()
+	if err == nil || err.Error() != "row 1 has 1 values, expected 2" {
+		t.Errorf("expected error for ragged rows, got: %v", err)
+	}
+
+	_, _, err = Values(nil).ToSql()
+	if err == nil {
+		t.Errorf("expected error for no rows")
+	}
+}
+
+func TestNot(t *testing.T) {
+	sql, params, err := Not(New("a = ?", 1).Or("b = ?", 2)).ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "NOT (a = $1 OR b = $2)"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{1, 2}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	sql, _, _ = Not("active").ToSql()
+	if sql != "NOT (active)" {
+		t.Errorf("got: %q, want: %q", sql, "NOT (active)")
+	}
+}
+
+func TestIdent(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		parts   []string
+		want    string
+	}{
+		{PGSQL, []string{"order"}, `"order"`},
+		{PGSQL, []string{"public", "users", "name"}, `"public"."users"."name"`},
+		{PGSQL, []string{`we"ird`}, `"we""ird"`},
+		{SQLITE, []string{"main", "order"}, `"main"."order"`},
+		{MYSQL, []string{"shop", "order"}, "`shop`.`order`"},
+		{MYSQL, []string{"we`ird"}, "`we``ird`"},
+		{MSSQL, []string{"dbo", "order"}, "[dbo].[order]"},
+		{MSSQL, []string{"we]ird"}, "[we]]ird]"},
+	}
+
+	for _, tt := range tests {
+		if got := Ident(tt.dialect, tt.parts...); got != tt.want {
+			t.Errorf("got: %s, want: %s", got, tt.want)
+		}
+	}
+
+	sql, _, _ := New("SELECT ? FROM t", Embedded(Ident(PGSQL, "order"))).ToPgsql()
+	if sql != `SELECT "order" FROM t` {
+		t.Errorf("got unexpected sql: %s", sql)
+	}
+}
+
+func TestUnion(t *testing.T) {
+	a := New("SELECT id FROM a WHERE x = ?", 1)
+	b := New("SELECT id FROM b WHERE y = ?", 2)
+
+	q := UnionAll(PGSQL, a, b).Space("ORDER BY id").Limit(10)
+	sql, params, err := q.ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "(SELECT id FROM a WHERE x = $1) UNION ALL (SELECT id FROM b WHERE y = $2) ORDER BY id LIMIT 10"
+	if sql != want {
+		t.Errorf("\n got: %q\nwant: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{1, 2}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	tests := []struct {
+		q    *Query
+		want string
+	}{
+		{Union(SQLITE, a, b), "SELECT id FROM a WHERE x = ? UNION SELECT id FROM b WHERE y = ?"},
+		{Intersect(PGSQL, a, b), "(SELECT id FROM a WHERE x = ?) INTERSECT (SELECT id FROM b WHERE y = ?)"},
+		{Except(PGSQL, a, b), "(SELECT id FROM a WHERE x = ?) EXCEPT (SELECT id FROM b WHERE y = ?)"},
+		{Except(ORACLE, a, b), "(SELECT id FROM a WHERE x = ?) MINUS (SELECT id FROM b WHERE y = ?)"},
+	}
+	for _, tt := range tests {
+		sql, _, err := tt.q.ToSql()
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		if sql != tt.want {
+			t.Errorf("\n got: %q\nwant: %q", sql, tt.want)
+		}
+	}
+
+	for _, bad := range []*Query{
+		Intersect(MYSQL, a, b),
+		Except(MYSQL, a, b),
+		Union(PGSQL, a),
+		Union(PGSQL, a, nil),
+	} {
+		if _, _, err := bad.ToSql(); err == nil {
+			t.Errorf("expected error for %v", bad)
+		}
+	}
+}
+
+func TestAny(t *testing.T) {
+	ids := []int{1, 2, 3}
+	q := New("SELECT * FROM users WHERE ? AND team = ?", Any(PGSQL, "id", "=", ids), "a")
+	sql, params, err := q.ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "SELECT * FROM users WHERE id = ANY($1) AND team = $2"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{ids, "a"}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	sql, params, _ = All(PGSQL, "price", ">", []float64{1.5, 2}).ToPgsql()
+	want = "price > ALL($1)"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{[]float64{1.5, 2}}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	_, _, err = Any(MYSQL, "id", "=", ids).ToMysql()
+	if err == nil || err.Error() != "ANY is not supported by mysql" {
+		t.Errorf("got unexpected error: %v", err)
+	}
+}
+
+func TestCast(t *testing.T) {
+	tests := []struct {
+		q         *Query
+		want      string
+		wantParam []any
+	}{
+		{Cast("price", "integer"), "CAST(price AS integer)", nil},
+		{Cast(42, "text"), "CAST($1 AS text)", []any{42}},
+		{Cast(New("?", "2023-01-01"), "date"), "CAST($1 AS date)", []any{"2023-01-01"}},
+		{Cast(Coalesce("a", 0), "bigint"), "CAST(COALESCE(a,$1) AS bigint)", []any{0}},
+	}
+
+	for _, tt := range tests {
+		sql, params, err := tt.q.ToPgsql()
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		if sql != tt.want {
+			t.Errorf("got: %q, want: %q", sql, tt.want)
+		}
+		if !reflect.DeepEqual(params, tt.wantParam) {
+			t.Errorf("got params: %v, want: %v", params, tt.wantParam)
+		}
+	}
+}
+
+func TestJsonExtract(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		path    string
+		want    string
+	}{
+		{PGSQL, "a", "data->>'a'"},
+		{PGSQL, "a.b", "data #>> '{a,b}'"},
+		{PGSQL, "a.b c", `data #>> '{a,"b c"}'`},
+		{MYSQL, "a.b", "JSON_UNQUOTE(JSON_EXTRACT(data, '$.a.b'))"},
+		{MYSQL, "a.it's", `JSON_UNQUOTE(JSON_EXTRACT(data, '$.a."it''s"'))`},
+		{SQLITE, "a.b", "json_extract(data, '$.a.b')"},
+		{MSSQL, "a.b", "JSON_VALUE(data, '$.a.b')"},
+	}
+
+	for _, tt := range tests {
+		sql, params, err := JsonExtract(tt.dialect, "data", tt.path).Sql(tt.dialect)
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		if sql != tt.want {
+			t.Errorf("%v got: %q, want: %q", tt.dialect, sql, tt.want)
+		}
+		if len(params) != 0 {
+			t.Errorf("got unexpected params: %v", params)
+		}
+	}
+
+	_, _, err := JsonExtract(PGSQL, "data", "a..b").ToPgsql()
+	if err == nil || err.Error() != `invalid json path: "a..b"` {
+		t.Errorf("got unexpected error: %v", err)
+	}
+
+	_, err = JsonExtract(RAW, "data", "a").ToRaw()
+	if err == nil || err.Error() != "JsonExtract is not supported by raw" {
+		t.Errorf("got unexpected error: %v", err)
+	}
+}
+
+func TestAggregates(t *testing.T) {
+	tests := []struct {
+		q         *Query
+		want      string
+		wantParam []any
+	}{
+		{Count("*"), "COUNT(*)", nil},
+		{CountDistinct("email"), "COUNT(DISTINCT email)", nil},
+		{Sum(New("CASE WHEN status = ? THEN amount ELSE 0 END", "paid")), "SUM(CASE WHEN status = $1 THEN amount ELSE 0 END)", []any{"paid"}},
+		{Avg("age"), "AVG(age)", nil},
+		{Min("created_at"), "MIN(created_at)", nil},
+		{Max(Coalesce("score", 0)), "MAX(COALESCE(score,$1))", []any{0}},
+	}
+
+	for _, tt := range tests {
+		sql, params, err := tt.q.ToPgsql()
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		if sql != tt.want {
+			t.Errorf("got: %q, want: %q", sql, tt.want)
+		}
+		if !reflect.DeepEqual(params, tt.wantParam) {
+			t.Errorf("got params: %v, want: %v", params, tt.wantParam)
+		}
+	}
+}
+
+func TestOver(t *testing.T) {
+	q := New("SELECT name, ? AS rank FROM employees",
+		Over("ROW_NUMBER()").PartitionBy("dept").OrderBy("salary", DESC).Build())
+	sql, _, err := q.ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "SELECT name, ROW_NUMBER() OVER (PARTITION BY dept ORDER BY salary DESC) AS rank FROM employees"
+	if sql != want {
+		t.Errorf("\n got: %q\nwant: %q", sql, want)
+	}
+
+	sql, params, _ := Over(New("SUM(amount * ?)", 2)).
+		PartitionBy("dept", "team").
+		OrderBy(Coalesce("hired_at", 0), ASC).
+		OrderBy("id", DESC).
+		Build().ToPgsql()
+	want = "SUM(amount * $1) OVER (PARTITION BY dept, team ORDER BY COALESCE(hired_at,$2) ASC, id DESC)"
+	if sql != want {
+		t.Errorf("\n got: %q\nwant: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{2, 0}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	sql, _, _ = Over("COUNT(*)").Build().ToPgsql()
+	want = "COUNT(*) OVER ()"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	_, _, err = Over("RANK()").OrderBy("id", "UP").Build().ToPgsql()
+	if err == nil || err.Error() != "invalid order direction: UP" {
+		t.Errorf("got unexpected error: %v", err)
+	}
+}
+
+func TestGreatest(t *testing.T) {
+	tests := []struct {
+		q         *Query
+		dialect   Dialect
+		want      string
+		wantParam []any
+	}{
+		{Greatest(PGSQL, "a", "b", 10), PGSQL, "GREATEST(a,b,$1)", []any{10}},
+		{Least(MYSQL, "a", New("b * ?", 2)), MYSQL, "LEAST(a,b * ?)", []any{2}},
+		{Greatest(SQLITE, "a", 10), SQLITE, "MAX(a,?)", []any{10}},
+		{Least(SQLITE, "a", "b"), SQLITE, "MIN(a,b)", nil},
+	}
+
+	for _, tt := range tests {
+		sql, params, err := tt.q.Sql(tt.dialect)
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		if sql != tt.want {
+			t.Errorf("got: %q, want: %q", sql, tt.want)
+		}
+		if !reflect.DeepEqual(params, tt.wantParam) {
+			t.Errorf("got params: %v, want: %v", params, tt.wantParam)
+		}
+	}
+}
+
+func TestNullif(t *testing.T) {
+	tests := []struct {
+		q         *Query
+		want      string
+		wantParam []any
+	}{
+		{Nullif("count", 0), "NULLIF(count,$1)", []any{0}},
+		{Nullif(New("a + ?", 1), New("b * ?", 2)), "NULLIF(a + $1,b * $2)", []any{1, 2}},
+		{New("total / ?", Nullif("count", 0)), "total / NULLIF(count,$1)", []any{0}},
+	}
+
+	for _, tt := range tests {
+		sql, params, err := tt.q.ToPgsql()
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		if sql != tt.want {
+			t.Errorf("got: %q, want: %q", sql, tt.want)
+		}
+		if !reflect.DeepEqual(params, tt.wantParam) {
+			t.Errorf("got params: %v, want: %v", params, tt.wantParam)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	var nilInt *int
+	tests := []struct {
+		q         *Query
+		want      string
+		wantParam []any
+	}{
+		{Eq("id", 5), "id = $1", []any{5}},
+		{Neq("name", "a"), "name <> $1", []any{"a"}},
+		{Gt("age", 21), "age > $1", []any{21}},
+		{Gte("age", 21), "age >= $1", []any{21}},
+		{Lt("age", 65), "age < $1", []any{65}},
+		{Lte("age", 65), "age <= $1", []any{65}},
+		{Eq("u.team_id", New("t.id")), "u.team_id = t.id", nil},
+		{Gt("total", New("(SELECT AVG(total) FROM orders WHERE year = ?)", 2023)), "total > (SELECT AVG(total) FROM orders WHERE year = $1)", []any{2023}},
+		{Eq("deleted_at", nil), "deleted_at IS NULL", nil},
+		{Eq("parent_id", nilInt), "parent_id IS NULL", nil},
+		{Neq("deleted_at", nil), "deleted_at IS NOT NULL", nil},
+	}
+
+	for _, tt := range tests {
+		sql, params, err := tt.q.ToPgsql()
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		if sql != tt.want {
+			t.Errorf("got: %q, want: %q", sql, tt.want)
+		}
+		if !reflect.DeepEqual(params, tt.wantParam) {
+			t.Errorf("got params: %v, want: %v", params, tt.wantParam)
+		}
+	}
+}
+
+func TestTuple(t *testing.T) {
+	sql, params, err := Tuple("a", "b").In([][]any{{1, "x"}, {2, "y"}}).ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "(a,b) IN (($1,$2),($3,$4))"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{1, "x", 2, "y"}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	sql, params, _ = Tuple("a", "b").Eq(1, "x").ToPgsql()
+	want = "(a,b) = ($1,$2)"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{1, "x"}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	sql, _, _ = Tuple("a", "b").In(nil).ToPgsql()
+	if sql != "1=0" {
+		t.Errorf("got: %q, want: %q", sql, "1=0")
+	}
+
+	_, _, err = Tuple("a", "b").In([][]any{{1, "x"}, {2}}).ToPgsql()
+	if err == nil || err.Error() != "row 1 has 1 values, expected 2" {
+		t.Errorf("got unexpected error: %v", err)
+	}
+}
+
+func TestCol(t *testing.T) {
+	tests := []struct {
+		q    *Query
+		want string
+	}{
+		{Eq("a.id", Col("b.user_id")), "a.id = b.user_id"},
+		{Gte("o.total", Col("u.credit_limit")), "o.total >= u.credit_limit"},
+		{Between("t.day", Col("p.starts"), Col("p.ends")), "t.day BETWEEN p.starts AND p.ends"},
+	}
+	for _, tt := range tests {
+		sql, params, err := tt.q.ToPgsql()
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		if sql != tt.want {
+			t.Errorf("got: %q, want: %q", sql, tt.want)
+		}
+		if len(params) != 0 {
+			t.Errorf("got unexpected params: %v", params)
+		}
+	}
+
+	sql, _, _ := New("SELECT * FROM users u").LeftJoin("orders o", Eq("o.user_id", Col("u.id"))).ToPgsql()
+	if want := "SELECT * FROM users u LEFT JOIN orders o ON (o.user_id = u.id)"; sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	for _, name := range []string{"b.id; DROP TABLE users", "b.id = 1 OR 1", "", "?"} {
+		if _, _, err := Eq("a.id", Col(name)).ToPgsql(); err == nil {
+			t.Errorf("expected an error for column %q", name)
+		}
+	}
+}
+
+func TestConcat(t *testing.T) {
+	tests := []struct {
+		q         *Query
+		dialect   Dialect
+		want      string
+		wantParam []any
+	}{
+		{Concat(Col("first_name"), " ", Col("last_name")), PGSQL, "first_name || $1 || last_name", []any{" "}},
+		{Concat(Col("name"), "!"), SQLITE, "name || ?", []any{"!"}},
+		{Concat(Col("name"), "!"), MYSQL, "CONCAT(name,?)", []any{"!"}},
+		{Concat(Col("name"), "!", 1), MSSQL, "CONCAT(name,@p1,@p2)", []any{"!", 1}},
+		{Concat("a", Concat(Col("b"), "c")), MYSQL, "CONCAT(?,CONCAT(b,?))", []any{"a", "c"}},
+		{New("WHERE x = ?", Concat(Col("a"), "b")), SQL, "WHERE x = a || ?", []any{"b"}},
+	}
+
+	for _, tt := range tests {
+		sql, params, err := tt.q.Sql(tt.dialect)
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		if sql != tt.want {
+			t.Errorf("got: %q, want: %q", sql, tt.want)
+		}
+		if !reflect.DeepEqual(params, tt.wantParam) {
+			t.Errorf("got params: %v, want: %v", params, tt.wantParam)
+		}
+	}
+
+	_, _, err := Concat().ToPgsql()
+	if err == nil {
+		t.Error("expected an error for Concat without args")
+	}
+
+	_, _, err = New("?", "{{xX_CONCAT_SEP_Xx}}").ToSql()
+	if err != nil {
+		t.Errorf("got error for bound placeholder text: %v", err)
+	}
+	_, _, err = New("a {{xX_CONCAT_SEP_Xx}} b").ToSql()
+	if err == nil {
+		t.Error("expected an error for reserved placeholder in text")
+	}
+}
+
+func TestInsertSelect(t *testing.T) {
+	src := New("SELECT name, email FROM signups WHERE created_at > ?", "2023-01-01").
+		And("confirmed = ?", true)
+	q := InsertSelect("users", []string{"name", "email"}, src).OnConflictDoNothing("email")
+
+	sql, params, err := q.ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "INSERT INTO users (name,email) SELECT name, email FROM signups WHERE created_at > $1 AND confirmed = $2 ON CONFLICT (email) DO NOTHING"
+	if sql != want {
+		t.Errorf("\n got: %q\nwant: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{"2023-01-01", true}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	sql, _, _ = InsertSelect("archive", nil, New("SELECT * FROM users")).ToPgsql()
+	want = "INSERT INTO archive SELECT * FROM users"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	_, _, err = InsertSelect("users", nil, nil).ToPgsql()
+	if err == nil {
+		t.Errorf("expected an error for a nil source")
+	}
+}
+
+func TestInChunked(t *testing.T) {
+	values := make([]any, 2500)
+	for i := range values {
+		values[i] = i
+	}
+
+	sql, params, err := InChunked("id", values, 1000).ToOracle()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	if got := strings.Count(sql, "id IN ("); got != 3 {
+		t.Errorf("got %d IN lists, want 3", got)
+	}
+	if !strings.HasPrefix(sql, "(id IN (:1,") || !strings.Contains(sql, ",:1000) OR id IN (:1001,") ||
+		!strings.HasSuffix(sql, ",:2500))") {
+		t.Errorf("got unexpected sql: %.100q...", sql)
+	}
+	if !reflect.DeepEqual(params, values) {
+		t.Errorf("got %d params, want %d in order", len(params), len(values))
+	}
+
+	tests := []struct {
+		q         *Query
+		want      string
+		wantParam []any
+	}{
+		{InChunked("id", []any{1, 2, 3}, 2), "(id IN (?,?) OR id IN (?))", []any{1, 2, 3}},
+		{InChunked("id", []any{[]int{1, 2, 3}}, 2), "(id IN (?,?) OR id IN (?))", []any{1, 2, 3}},
+		{InChunked("id", []any{1, 2, 3}, 0), "id IN (?,?,?)", []any{1, 2, 3}},
+		{InChunked("id", []any{1, 2}, 2), "id IN (?,?)", []any{1, 2}},
+		{InChunked("id", nil, 2), "1=0", nil},
+	}
+	for _, tt := range tests {
+		sql, params, err := tt.q.ToSql()
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		if sql != tt.want {
+			t.Errorf("got: %q, want: %q", sql, tt.want)
+		}
+		if !reflect.DeepEqual(params, tt.wantParam) {
+			t.Errorf("got params: %v, want: %v", params, tt.wantParam)
+		}
+	}
+
+	_, _, err = InChunked("id", []any{1}, -1).ToSql()
+	if err == nil || err.Error() != "invalid negative chunk size: -1" {
+		t.Errorf("got unexpected error: %v", err)
+	}
+}
+
+func TestLikeAny(t *testing.T) {
+	patterns := []string{"%a%", "%b%"}
+	tests := []struct {
+		q         *Query
+		dialect   Dialect
+		want      string
+		wantParam []any
+	}{
+		{LikeAny(PGSQL, "name", patterns), PGSQL, "name LIKE ANY($1)", []any{patterns}},
+		{ILikeAny(PGSQL, "name", patterns), PGSQL, "name ILIKE ANY($1)", []any{patterns}},
+		{LikeAny(MYSQL, "name", patterns), MYSQL, "(name LIKE ? OR name LIKE ?)", []any{"%a%", "%b%"}},
+		{ILikeAny(MYSQL, "name", patterns), MYSQL, "(LOWER(name) LIKE LOWER(?) OR LOWER(name) LIKE LOWER(?))", []any{"%a%", "%b%"}},
+		{LikeAny(SQLITE, "name", patterns[:1]), SQLITE, "name LIKE ?", []any{"%a%"}},
+		{LikeAny(PGSQL, "name", nil), PGSQL, "1=0", nil},
+		{ILikeAny(MYSQL, "name", []string{}), MYSQL, "1=0", nil},
+	}
+
+	for _, tt := range tests {
+		sql, params, err := tt.q.Sql(tt.dialect)
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		if sql != tt.want {
+			t.Errorf("got: %q, want: %q", sql, tt.want)
+		}
+		if !reflect.DeepEqual(params, tt.wantParam) {
+			t.Errorf("got params: %v, want: %v", params, tt.wantParam)
+		}
+	}
+}
+
+func TestDateMath(t *testing.T) {
+	tests := []struct {
+		q       *Query
+		dialect Dialect
+		want    string
+	}{
+		{DateSub(PGSQL, "now()", 7, DAY), PGSQL, "now() - interval '7 day'"},
+		{DateSub(MYSQL, "NOW()", 7, DAY), MYSQL, "DATE_SUB(NOW(), INTERVAL 7 DAY)"},
+		{DateAdd(PGSQL, "created_at", 2, HOUR), PGSQL, "created_at + interval '2 hour'"},
+		{DateAdd(MYSQL, "created_at", 2, HOUR), MYSQL, "DATE_ADD(created_at, INTERVAL 2 HOUR)"},
+		{DateSub(SQLITE, "'now'", 7, DAY), SQLITE, "datetime('now', '-7 days')"},
+		{DateAdd(SQLITE, "created_at", 2, WEEK), SQLITE, "datetime(created_at, '+14 days')"},
+		{DateSub(MSSQL, "GETDATE()", 7, DAY), MSSQL, "DATEADD(day, -7, GETDATE())"},
+		{Interval(PGSQL, 3, MONTH), PGSQL, "interval '3 month'"},
+		{Interval(MYSQL, 3, MONTH), MYSQL, "INTERVAL 3 MONTH"},
+	}
+
+	for _, tt := range tests {
+		sql, params, err := tt.q.Sql(tt.dialect)
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		if sql != tt.want {
+			t.Errorf("got: %q, want: %q", sql, tt.want)
+		}
+		if len(params) != 0 {
+			t.Errorf("got unexpected params: %v", params)
+		}
+	}
+
+	sql, params, _ := New("created_at > ?", DateSub(PGSQL, New("?::timestamp", "2023-01-01"), 1, DAY)).ToPgsql()
+	if want := "created_at > $1::timestamp - interval '1 day'"; sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{"2023-01-01"}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	errTests := []struct {
+		q    *Query
+		want string
+	}{
+		{DateAdd(PGSQL, "now()", 1, "FORTNIGHT"), "invalid interval unit: FORTNIGHT"},
+		{Interval(SQLITE, 1, DAY), "Interval is not supported by sqlite"},
+		{DateAdd(ORACLE, "SYSDATE", 1, DAY), "date arithmetic is not supported by oracle"},
+	}
+	for _, tt := range errTests {
+		if err := tt.q.Err(); err == nil || err.Error() != tt.want {
+			t.Errorf("got error: %v, want: %v", err, tt.want)
+		}
+	}
+}
+
+func TestAssignments(t *testing.T) {
+	m := map[string]any{"name": "a", "age": 30, "team_id": New("(SELECT id FROM teams WHERE name = ?)", "t"), "deleted_at": nil}
+
+	for i := 0; i < 10; i++ {
+		sql, params, err := New("UPDATE users SET ? WHERE id = ?", Assignments(m), 5).ToPgsql()
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		want := `UPDATE users SET "age" = $1,"deleted_at" = $2,"name" = $3,"team_id" = (SELECT id FROM teams WHERE name = $4) WHERE id = $5`
+		if sql != want {
+			t.Errorf("\n got: %q\nwant: %q", sql, want)
+		}
+		if !reflect.DeepEqual(params, []any{30, nil, "a", "t", 5}) {
+			t.Errorf("got unexpected params: %v", params)
+		}
+	}
+
+	sql, _, _ := Assignments(map[string]any{"name": "a"}).ToMysql()
+	if want := "`name` = ?"; sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	if err := Assignments(map[string]any{`name" = 1; --`: "a"}).Err(); err == nil {
+		t.Errorf("expected an error for an invalid column")
+	}
+	if err := Assignments(nil).Err(); err == nil {
+		t.Errorf("expected an error for no values")
+	}
+}
+
+func TestComposeChained(t *testing.T) {
+	// Query.And and Query.Or take query text, so helpers are chained with
+	// "?" and grouped with "(?)" where OR has to bind before AND, which
+	// AndExpr and OrExpr do for a *Query.
+	chained := Eq("a", 1).And("?", Gt("b", 2)).Or("?", IsNull("c"))
+	nested := New("? AND ? OR ?", Eq("a", 1), Gt("b", 2), IsNull("c"))
+
+	grouped := Eq("a", 1).And("(?)", Gt("b", 2).Or("?", IsNull("c")))
+	groupedNested := New("? AND (? OR ?)", Eq("a", 1), Gt("b", 2), IsNull("c"))
+
+	tests := []struct {
+		got, want *Query
+		sql       string
+	}{
+		{chained, nested, "a = $1 AND b > $2 OR c IS NULL"},
+		{grouped, groupedNested, "a = $1 AND (b > $2 OR c IS NULL)"},
+		{
+			Eq("a", 1).AndExpr(Gt("b", 2).Or("?", IsNull("c"))),
+			New("? AND ?", Eq("a", 1), AnyOf(Gt("b", 2), IsNull("c"))),
+			"a = $1 AND (b > $2 OR c IS NULL)",
+		},
+		{
+			Eq("a", 1).AndExpr(Gt("b", 2)).OrExpr(IsNull("c")).AndExpr(nil).OrExpr(Q()),
+			New("? AND (?) OR (?)", Eq("a", 1), Gt("b", 2), IsNull("c")),
+			"a = $1 AND (b > $2) OR (c IS NULL)",
+		},
+	}
+	for _, tt := range tests {
+		sql, params, err := tt.got.ToPgsql()
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		wantSql, wantParams, _ := tt.want.ToPgsql()
+		if sql != tt.sql || sql != wantSql {
+			t.Errorf("got: %q, want: %q", sql, tt.sql)
+		}
+		if !reflect.DeepEqual(params, wantParams) || !reflect.DeepEqual(params, []any{1, 2}) {
+			t.Errorf("got params: %v, want: %v", params, wantParams)
+		}
+	}
+}
+
+func TestExprErrorsSurface(t *testing.T) {
+	ragged := Tuple("a", "b").In([][]any{{1, "x"}, {2}})
+	badUnit := Interval(PGSQL, 1, IntervalUnit("FORTNIGHT"))
+
+	where := Eq("c", 1).And("(?)", Not(ragged)).And("d > NOW() - ?", badUnit)
+	q := New("SELECT * FROM t WHERE ?", where)
+	outer := New("SELECT id FROM (?) sub", q)
+
+	err := outer.Err()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{"row 1 has 1 values, expected 2", "FORTNIGHT"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+
+	if _, _, err := outer.ToPgsql(); err == nil {
+		t.Error("expected error from ToPgsql")
+	}
+}
+
+func TestAnyOfAllOf(t *testing.T) {
+	tests := []struct {
+		got, want *Query
+		sql       string
+		params    []any
+	}{
+		{
+			AnyOf(Eq("a", 1), Gt("b", 2), IsNull("c")),
+			New("(? OR ? OR ?)", Eq("a", 1), Gt("b", 2), IsNull("c")),
+			"(a = $1 OR b > $2 OR c IS NULL)", []any{1, 2},
+		},
+		{
+			AllOf(Eq("a", 1), AnyOf(Eq("b", 2), Eq("b", 3))),
+			New("(? AND (? OR ?))", Eq("a", 1), Eq("b", 2), Eq("b", 3)),
+			"(a = $1 AND (b = $2 OR b = $3))", []any{1, 2, 3},
+		},
+		{AllOf(nil, Q(), Eq("a", 1)), New("(?)", Eq("a", 1)), "(a = $1)", []any{1}},
+		{AnyOf(), New("1=0"), "1=0", nil},
+		{AllOf(), New("1=1"), "1=1", nil},
+	}
+
+	for _, tt := range tests {
+		sql, params, err := tt.got.ToPgsql()
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		wantSql, _, _ := tt.want.ToPgsql()
+		if sql != tt.sql || sql != wantSql {
+			t.Errorf("got: %q, want: %q", sql, tt.sql)
+		}
+		if strings.TrimSpace(sql) != sql {
+			t.Errorf("got surrounding whitespace in %q", sql)
+		}
+		if !reflect.DeepEqual(params, tt.params) {
+			t.Errorf("got params: %v, want: %v", params, tt.params)
+		}
+	}
+}
+
+func TestAnyOfAllOfGroups(t *testing.T) {
+	tests := []struct {
+		q    *Query
+		want string
+	}{
+		{AnyOf(AllOf(Eq("a", 1), Eq("b", 2))), "(a = ? AND b = ?)"},
+		{AnyOf(AllOf(Eq("a", 1), Eq("b", 2)), AllOf(Eq("c", 3))), "((a = ? AND b = ?) OR (c = ?))"},
+		{AnyOf(AllOf(Eq("a", 1), Q()), nil), "(a = ?)"},
+		{AnyOf(AllOf(), Eq("c", 3)), "(c = ?)"},
+		{AllOf(AnyOf(), AllOf(AnyOf())), "1=1"},
+		{AnyOf(AllOf(AnyOf()), AnyOf()), "1=0"},
+		{AllOf(AnyOf().And("a = ?", 1)), "(1=0 AND a = ?)"},
+	}
+
+	for _, tt := range tests {
+		sql, _, err := tt.q.ToSql()
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		if sql != tt.want {
+			t.Errorf("got: %q, want: %q", sql, tt.want)
+		}
+	}
+}
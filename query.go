@@ -1,9 +1,11 @@
 package bqb
 
 import (
+	"database/sql"
 	"errors"
 	"fmt"
 	"strings"
+	"sync/atomic"
 )
 
 // QueryPart holds a section of a Query.
@@ -18,6 +20,44 @@ type QueryPart struct {
 type Query struct {
 	Parts          []QueryPart
 	OptionalPrefix string
+
+	prefixes  []QueryPart
+	suffixes  []QueryPart
+	ctes      []QueryPart
+	recursive bool
+	limit     *int
+	offset    *int
+	orders    []string
+	lock      string
+
+	// joins are rendered before Parts[*joinsAt], which is set where the
+	// first From, Where, Having or join was added, so that they follow FROM
+	// and come before WHERE whatever order the methods are called in.
+	joins   []QueryPart
+	joinsAt *int
+
+	// clauseKeyword is the keyword of the last Where or Having clause, which
+	// spans Parts[clauseStart:clauseEnd], so that a following call for the
+	// same keyword can add to it with AND.
+	clauseKeyword string
+	clauseStart   int
+	clauseEnd     int
+
+	// grouped is set on the result of AllOf and AnyOf, which is already
+	// wrapped in parentheses, and noConds when it had no conds to join, so
+	// that an enclosing group skips its 1=1 or 1=0. Any change clears both.
+	grouped bool
+	noConds bool
+
+	// cache holds the sql rendered by Build for each dialect, as an
+	// immutable map[Dialect]string that's replaced rather than modified.
+	cache atomic.Value
+}
+
+// Build renders a single expression for dialect, as a shorthand for
+// New(text, args...).Sql(dialect) when no other query methods are needed.
+func Build(dialect Dialect, text string, args ...any) (string, []any, error) {
+	return New(text, args...).Sql(dialect)
 }
 
 // New returns an instance of Query with a single QueryPart.
@@ -27,6 +67,17 @@ func New(text string, args ...any) *Query {
 	return q
 }
 
+// NewNamed returns an instance of Query with a single QueryPart, using
+// `:name` placeholders that are looked up in args. A name may be used more
+// than once, in which case its value is bound once for each use.
+func NewNamed(text string, args map[string]any) *Query {
+	text, positional, err := namedToPositional(text, args)
+	if err != nil {
+		return Q().addErr(err)
+	}
+	return New(text, positional...)
+}
+
 // Q returns a new empty Query
 func Q() *Query {
 	return &Query{}
@@ -48,6 +99,125 @@ func (q *Query) And(text string, args ...any) *Query {
 	return q.Join(" AND ", text, args...)
 }
 
+// AndExpr joins expr to the query with ' AND ', wrapped in parentheses so
+// an OR within it binds first, e.g. Eq("a", 1).AndExpr(AnyOf(...)). A nil or
+// empty expr adds nothing.
+func (q *Query) AndExpr(expr *Query) *Query {
+	if expr.Empty() {
+		return q
+	}
+	return q.And("(?)", expr)
+}
+
+// AndIf calls And only when cond is true, which avoids wrapping optional
+// filters in if blocks.
+func (q *Query) AndIf(cond bool, text string, args ...any) *Query {
+	if !cond {
+		return q
+	}
+	return q.And(text, args...)
+}
+
+// Args returns the parameters that Sql would return for dialect, along with
+// any errors found while adding parts, without rendering the sql. The
+// parameters are bound in the same order for every dialect.
+func (q *Query) Args(dialect Dialect) ([]any, error) {
+	if q == nil {
+		return nil, errors.New("cannot get args on nil Query")
+	}
+	all := [][]QueryPart{q.prefixes, q.ctes, q.body(), q.suffixes}
+	count := 0
+	for _, parts := range all {
+		for _, p := range parts {
+			count += len(p.Params)
+		}
+	}
+	var params []any
+	if count > 0 {
+		params = make([]any, 0, count)
+	}
+
+	var errs []error
+	for _, parts := range all {
+		for _, p := range parts {
+			params = append(params, p.Params...)
+			errs = append(errs, p.Errs...)
+		}
+	}
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+	return params, nil
+}
+
+// Build is like Sql, but caches the sql for dialect so that building the
+// same query again only collects its parameters. The cache is cleared by
+// any method that changes the query, but not by changes made to Parts
+// directly. Raw and custom dialects aren't cached, as their sql may depend
+// on the parameter values.
+func (q *Query) Build(dialect Dialect) (string, []any, error) {
+	if q == nil {
+		return "", nil, errors.New("cannot get sql on nil Query")
+	}
+	if !cacheable(dialect) {
+		return q.Sql(dialect)
+	}
+	cache, _ := q.cache.Load().(map[Dialect]string)
+	if sql, ok := cache[dialect]; ok {
+		params, err := q.Args(dialect)
+		return sql, params, err
+	}
+
+	sql, params, err := q.Sql(dialect)
+	if err != nil {
+		return "", nil, err
+	}
+	updated := make(map[Dialect]string, len(cache)+1)
+	for d, s := range cache {
+		updated[d] = s
+	}
+	updated[dialect] = sql
+	q.cache.Store(updated)
+	return sql, params, nil
+}
+
+// Clone returns a copy of the Query that can be extended without changing
+// the original, e.g. to build variants of a common base query.
+func (q *Query) Clone() *Query {
+	if q == nil {
+		return nil
+	}
+	clone := &Query{
+		Parts:          cloneParts(q.Parts),
+		OptionalPrefix: q.OptionalPrefix,
+		prefixes:       cloneParts(q.prefixes),
+		suffixes:       cloneParts(q.suffixes),
+		ctes:           cloneParts(q.ctes),
+		recursive:      q.recursive,
+		joins:          cloneParts(q.joins),
+		orders:         append([]string(nil), q.orders...),
+		lock:           q.lock,
+		clauseKeyword:  q.clauseKeyword,
+		clauseStart:    q.clauseStart,
+		clauseEnd:      q.clauseEnd,
+		grouped:        q.grouped,
+		noConds:        q.noConds,
+	}
+	if q.limit != nil {
+		limit := *q.limit
+		clone.limit = &limit
+	}
+	if q.offset != nil {
+		offset := *q.offset
+		clone.offset = &offset
+	}
+	if q.joinsAt != nil {
+		joinsAt := *q.joinsAt
+		clone.joinsAt = &joinsAt
+	}
+	return clone
+}
+
 // Comma joins the current QueryPart to the previous QueryPart with a comma.
 func (q *Query) Comma(text string, args ...any) *Query {
 	if q == nil {
@@ -65,12 +235,159 @@ func (q *Query) Concat(text string, args ...any) *Query {
 	return q.Join("", text, args...)
 }
 
+// CountQuery returns a query that counts the rows of q, e.g. for the total
+// of a paginated query. bqb doesn't parse sql, so q is used as a derived
+// table, `SELECT COUNT(*) FROM (q) count_query`, without its OrderBy,
+// Limit, Offset, row locking, Prefix and Suffix clauses. All of its other
+// clauses and parameters are kept.
+func (q *Query) CountQuery() *Query {
+	if q == nil {
+		return Q().addErr(errors.New("cannot count nil Query"))
+	}
+	unlimited := &Query{
+		Parts:          q.Parts,
+		OptionalPrefix: q.OptionalPrefix,
+		ctes:           q.ctes,
+		recursive:      q.recursive,
+		joins:          q.joins,
+		joinsAt:        q.joinsAt,
+	}
+	// No AS before the alias, since Oracle doesn't allow it
+	return New("SELECT COUNT(*) FROM (?) count_query", unlimited)
+}
+
+// CrossJoin adds a `CROSS JOIN table` clause. The table may be a string or a
+// *Query, which is inlined with its parameters. See InnerJoin.
+func (q *Query) CrossJoin(table any) *Query {
+	return q.addJoin("CROSS JOIN ?", fragmentArgs([]any{table}))
+}
+
+// Distinct adds `DISTINCT`, e.g. `New("SELECT").Distinct().Space("name")`.
+func (q *Query) Distinct() *Query {
+	return q.Space("DISTINCT")
+}
+
+// DistinctOn adds a postgres `DISTINCT ON (cols)` clause. Any other dialect,
+// or no cols, results in an error when the query is built.
+func (q *Query) DistinctOn(dialect Dialect, cols ...string) *Query {
+	if dialect != PGSQL && dialect != COCKROACH {
+		return q.addErr(fmt.Errorf("DISTINCT ON is not supported by %v", dialect))
+	}
+	if len(cols) == 0 {
+		return q.addErr(errors.New("DISTINCT ON requires columns"))
+	}
+	return q.Space("DISTINCT ON (" + strings.Join(cols, ", ") + ")")
+}
+
 // Empty returns true if the Query is nil or has a length > 0.
 func (q *Query) Empty() bool {
 	if q == nil {
 		return true
 	}
-	return q.Len() == 0
+	return q.Len() == 0 && len(q.joins) == 0
+}
+
+// Err returns the errors found while adding parts to the Query, such as a
+// mismatched number of ? and args, without having to render it.
+func (q *Query) Err() error {
+	if q == nil {
+		return errors.New("cannot get error on nil Query")
+	}
+	var errs []error
+	for _, parts := range [][]QueryPart{q.prefixes, q.ctes, q.joins, q.Parts, q.suffixes} {
+		for _, p := range parts {
+			errs = append(errs, p.Errs...)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Explain adds an `EXPLAIN` prefix for dialect, with opts such as "ANALYZE"
+// or "FORMAT JSON". Postgres uses `EXPLAIN ANALYZE VERBOSE` when opts are
+// just those keywords in that order, and `EXPLAIN (ANALYZE, FORMAT JSON)`
+// otherwise. MySQL opts follow EXPLAIN as is, e.g. "FORMAT=JSON". SQLite
+// gets `EXPLAIN QUERY PLAN` and takes no opts. Any other dialect results in
+// an error when the query is built.
+func (q *Query) Explain(dialect Dialect, opts ...string) *Query {
+	text := "EXPLAIN"
+	switch dialect {
+	case PGSQL, COCKROACH:
+		switch keywords := strings.Join(opts, " "); keywords {
+		case "":
+		case "ANALYZE", "VERBOSE", "ANALYZE VERBOSE":
+			text += " " + keywords
+		default:
+			text += " (" + strings.Join(opts, ", ") + ")"
+		}
+	case MYSQL:
+		text = strings.Join(append([]string{text}, opts...), " ")
+	case SQLITE:
+		if len(opts) > 0 {
+			return q.addErr(fmt.Errorf("EXPLAIN options are not supported by %v", dialect))
+		}
+		text += " QUERY PLAN"
+	default:
+		return q.addErr(fmt.Errorf("EXPLAIN is not supported by %v", dialect))
+	}
+	return q.Prefix(text)
+}
+
+// ForShare sets a `FOR SHARE` row locking clause, which is added after any
+// Limit and Offset. Only postgres and mysql support it, any other dialect
+// results in an error when the query is built.
+func (q *Query) ForShare(dialect Dialect) *Query {
+	return q.setLock(dialect, "FOR SHARE")
+}
+
+// ForUpdate sets a `FOR UPDATE` row locking clause. See ForShare.
+func (q *Query) ForUpdate(dialect Dialect) *Query {
+	return q.setLock(dialect, "FOR UPDATE")
+}
+
+// From adds a `FROM table` clause with an optional alias. The table may be a
+// string or a *Query, which is used as a derived table,
+// `FROM (subquery) alias`, with its parameters inlined. An alias is required
+// for a *Query. There's no AS before the alias, since Oracle doesn't allow
+// it.
+func (q *Query) From(table any, alias ...string) *Query {
+	if len(alias) > 1 {
+		return q.addErr(fmt.Errorf("FROM takes one alias, got %d", len(alias)))
+	}
+	text := "FROM ?"
+	if sub, ok := table.(*Query); ok {
+		if len(alias) == 0 {
+			return q.addErr(errors.New("FROM subquery requires an alias"))
+		}
+		table, text = sub, "FROM (?)"
+	}
+	if len(alias) == 1 {
+		text += " " + alias[0]
+	}
+	q = q.Space(text, fragmentArgs([]any{table})...)
+	q.markJoins()
+	return q
+}
+
+// GroupBy adds a `GROUP BY cols` clause.
+func (q *Query) GroupBy(cols ...string) *Query {
+	return q.Space("GROUP BY " + strings.Join(cols, ", "))
+}
+
+// Having adds a `HAVING expr` clause. The expr may be query text with args,
+// e.g. `Having("COUNT(*) > ?", 5)`, or a *Query for composite conditions.
+// Like Where, repeated calls are joined with AND.
+func (q *Query) Having(expr any, args ...any) *Query {
+	return q.clause("HAVING", expr, args)
+}
+
+// InnerJoin adds an `INNER JOIN table ON (on)` clause. The table and on
+// condition may each be a string or a *Query, which is inlined with its
+// parameters. A string on condition may be query text used with args, e.g.
+// `InnerJoin("orders o", "o.user_id = u.id AND o.total > ?", 100)`.
+// Joins are kept in the order they're added, and are rendered after the
+// From clause and before Where, even when Where is called first.
+func (q *Query) InnerJoin(table, on any, args ...any) *Query {
+	return q.joinOn("INNER JOIN", table, on, args)
 }
 
 // Join joins the current QueryPart to the previous QueryPart with `sep`.
@@ -78,6 +395,7 @@ func (q *Query) Join(sep, text string, args ...any) *Query {
 	if q == nil {
 		return New(text, args...)
 	}
+	q.invalidate()
 	if len(q.Parts) > 0 {
 		q.Parts = append(q.Parts, makePart(sep+text, args...))
 	} else {
@@ -95,6 +413,62 @@ func (q *Query) Len() int {
 	return len(q.Parts)
 }
 
+// LeftJoin adds a `LEFT JOIN table ON (on)` clause. See InnerJoin.
+func (q *Query) LeftJoin(table, on any, args ...any) *Query {
+	return q.joinOn("LEFT JOIN", table, on, args)
+}
+
+// Limit sets the maximum number of rows returned by the query. The clause is
+// always added at the end of the query, and is rendered for the dialect the
+// query is built with, e.g. `LIMIT 10` for postgres or
+// `OFFSET 0 ROWS FETCH NEXT 10 ROWS ONLY` for SQL Server.
+func (q *Query) Limit(n int) *Query {
+	if q == nil {
+		q = Q()
+	}
+	if n < 0 {
+		return q.addErr(fmt.Errorf("invalid negative limit: %d", n))
+	}
+	q.invalidate()
+	q.limit = &n
+	return q
+}
+
+// MustSql is like Sql but panics if the query has an error.
+func (q *Query) MustSql(dialect Dialect) (string, []any) {
+	sql, params, err := q.Sql(dialect)
+	if err != nil {
+		panic(err)
+	}
+	return sql, params
+}
+
+// NamedArgs returns the query with @p1, @p2 placeholders, and its params as
+// sql.Named("p1", ...) values in the same order, for drivers that bind
+// parameters by name. The params can be passed straight to db.Query. Only
+// dialects with @name parameters, MSSQL and BIGQUERY, are supported.
+func (q *Query) NamedArgs(dialect Dialect) (string, []any, error) {
+	switch dialect {
+	case MSSQL, BIGQUERY:
+	default:
+		return "", nil, fmt.Errorf("named args are not supported by %v", dialect)
+	}
+	text, params, err := q.Sql(dialect)
+	if err != nil {
+		return "", nil, err
+	}
+	for i, p := range params {
+		params[i] = sql.Named(fmt.Sprintf("p%d", i+1), p)
+	}
+	return text, params, nil
+}
+
+// NoWait adds `NOWAIT` to the row locking clause, so the query fails rather
+// than waiting for locked rows. It must follow ForUpdate or ForShare.
+func (q *Query) NoWait() *Query {
+	return q.addLockOption("NOWAIT")
+}
+
 // Or joins the current QueryPart to the previous QueryPart with ' OR '.
 func (q *Query) Or(text string, args ...any) *Query {
 	if q == nil {
@@ -103,6 +477,100 @@ func (q *Query) Or(text string, args ...any) *Query {
 	return q.Join(" OR ", text, args...)
 }
 
+// OrExpr joins expr to the query with ' OR ', wrapped in parentheses. See
+// AndExpr.
+func (q *Query) OrExpr(expr *Query) *Query {
+	if expr.Empty() {
+		return q
+	}
+	return q.Or("(?)", expr)
+}
+
+// Offset sets the number of rows skipped by the query. Like Limit, it's
+// added at the end of the query in the form used by the dialect.
+func (q *Query) Offset(n int) *Query {
+	if q == nil {
+		q = Q()
+	}
+	if n < 0 {
+		return q.addErr(fmt.Errorf("invalid negative offset: %d", n))
+	}
+	q.invalidate()
+	q.offset = &n
+	return q
+}
+
+// OnConflictDoNothing adds a postgres/sqlite `ON CONFLICT (cols) DO NOTHING`
+// clause. The conflict target is omitted when no cols are given.
+func (q *Query) OnConflictDoNothing(cols ...string) *Query {
+	return q.Space(onConflict(cols) + " DO NOTHING")
+}
+
+// OnConflictDoUpdate adds a postgres/sqlite
+// `ON CONFLICT (cols) DO UPDATE SET a = ?,b = ?` clause.
+func (q *Query) OnConflictDoUpdate(cols []string, set ...Assignment) *Query {
+	if len(cols) == 0 || len(set) == 0 {
+		return q.addErr(errors.New("ON CONFLICT DO UPDATE requires columns and assignments"))
+	}
+	return q.Space(onConflict(cols)+" DO UPDATE SET ?", assignments(set))
+}
+
+// OnDuplicateKeyUpdate adds a MySQL `ON DUPLICATE KEY UPDATE a = ?,b = ?`
+// clause, the equivalent of OnConflictDoUpdate.
+func (q *Query) OnDuplicateKeyUpdate(set ...Assignment) *Query {
+	if len(set) == 0 {
+		return q.addErr(errors.New("ON DUPLICATE KEY UPDATE requires assignments"))
+	}
+	return q.Space("ON DUPLICATE KEY UPDATE ?", assignments(set))
+}
+
+// OrIf calls Or only when cond is true.
+func (q *Query) OrIf(cond bool, text string, args ...any) *Query {
+	if !cond {
+		return q
+	}
+	return q.Or(text, args...)
+}
+
+// OrderBy adds col to the `ORDER BY` clause, which is added at the end of the
+// query before any Limit and Offset. Columns are sorted in the order they're
+// added. An optional nulls argument renders `NULLS FIRST` or `NULLS LAST`,
+// which is emulated by first sorting on `col IS NULL` for MySQL and SQL
+// Server.
+func (q *Query) OrderBy(col string, dir Direction, nulls ...NullsOrder) *Query {
+	if q == nil {
+		q = Q()
+	}
+	if dir != ASC && dir != DESC {
+		return q.addErr(fmt.Errorf("invalid order direction: %v", dir))
+	}
+	if err := checkReserved(col); err != nil {
+		return q.addErr(err)
+	}
+	q.invalidate()
+	switch {
+	case len(nulls) == 0:
+		q.orders = append(q.orders, col+" "+string(dir))
+	case len(nulls) == 1 && (nulls[0] == NullsFirst || nulls[0] == NullsLast):
+		q.orders = append(q.orders, fmt.Sprintf(nullsPh, nulls[0], col)+" "+string(dir))
+	default:
+		return q.addErr(fmt.Errorf("invalid nulls order: %v", nulls))
+	}
+	return q
+}
+
+// Prefix adds text before the rest of the query, e.g. a comment or hint.
+// Multiple prefixes are added in the order they're called, separated by a
+// space.
+func (q *Query) Prefix(text string, args ...any) *Query {
+	if q == nil {
+		q = Q()
+	}
+	q.invalidate()
+	q.prefixes = append(q.prefixes, makePart(text, args...))
+	return q
+}
+
 // Print outputs the sql, parameters, and errors of a Query.
 func (q *Query) Print() {
 	sql, params, err := q.ToSql()
@@ -111,6 +579,70 @@ func (q *Query) Print() {
 	fmt.Printf("ERROR: %v\n", err)
 }
 
+// Reset clears the Query so that it can be reused, e.g. from a sync.Pool,
+// leaving it as it was when created by New or Optional without any parts.
+// The OptionalPrefix is kept, and the allocated parts are reused for the
+// parts added next.
+func (q *Query) Reset() *Query {
+	if q == nil {
+		return Q()
+	}
+	for _, parts := range [][]QueryPart{q.Parts, q.prefixes, q.suffixes, q.ctes, q.joins} {
+		for i := range parts {
+			parts[i] = QueryPart{}
+		}
+	}
+	q.invalidate()
+	q.Parts = q.Parts[:0]
+	q.prefixes = q.prefixes[:0]
+	q.suffixes = q.suffixes[:0]
+	q.ctes = q.ctes[:0]
+	q.joins = q.joins[:0]
+	q.joinsAt = nil
+	q.orders = q.orders[:0]
+	q.recursive = false
+	q.limit = nil
+	q.offset = nil
+	q.lock = ""
+	q.clauseKeyword = ""
+	return q
+}
+
+// Returning adds a `RETURNING` clause with each of cols quoted using Ident.
+// Qualified names are quoted part by part, e.g. "t.id" becomes "t"."id".
+// Only dialects that support RETURNING (postgres and sqlite) are allowed,
+// any other dialect results in an error when the query is built.
+func (q *Query) Returning(dialect Dialect, cols ...string) *Query {
+	switch dialect {
+	case PGSQL, COCKROACH, SQLITE:
+	default:
+		return q.addErr(fmt.Errorf("RETURNING is not supported by %v", dialect))
+	}
+
+	quoted := make([]string, len(cols))
+	for i, col := range cols {
+		parts := strings.Split(col, ".")
+		for j, part := range parts {
+			if part != "*" {
+				parts[j] = Ident(dialect, part)
+			}
+		}
+		quoted[i] = strings.Join(parts, ".")
+	}
+	return q.Space("RETURNING " + strings.Join(quoted, ","))
+}
+
+// RightJoin adds a `RIGHT JOIN table ON (on)` clause. See InnerJoin.
+func (q *Query) RightJoin(table, on any, args ...any) *Query {
+	return q.joinOn("RIGHT JOIN", table, on, args)
+}
+
+// SkipLocked adds `SKIP LOCKED` to the row locking clause, so rows locked by
+// other transactions are skipped. It must follow ForUpdate or ForShare.
+func (q *Query) SkipLocked() *Query {
+	return q.addLockOption("SKIP LOCKED")
+}
+
 // Space joins the current QueryPart to the previous QueryPart with a space.
 func (q *Query) Space(text string, args ...any) *Query {
 	if q == nil {
@@ -119,68 +651,382 @@ func (q *Query) Space(text string, args ...any) *Query {
 	return q.Join(" ", text, args...)
 }
 
-// ToMysql returns the sql placeholders with SQL (?) format used by MySQL
-func (q *Query) ToMysql() (string, []any, error) {
+// Suffix adds text at the very end of the query, after any Limit, Offset
+// and row locking clause, e.g. a SQL Server `OPTION (RECOMPILE)`. Multiple
+// suffixes are added in the order they're called, separated by a space.
+func (q *Query) Suffix(text string, args ...any) *Query {
+	if q == nil {
+		q = Q()
+	}
+	q.invalidate()
+	q.suffixes = append(q.suffixes, makePart(text, args...))
+	return q
+}
+
+// Sql returns the sql with placeholders converted for the given dialect.
+// Dialects added with RegisterDialect are supported as well as the built-in
+// ones.
+func (q *Query) Sql(dialect Dialect) (string, []any, error) {
 	sql, params, err := q.toSql()
 	if err != nil {
 		return "", nil, err
 	}
-	sql, err = dialectReplace(MYSQL, sql, params)
+	sql, err = dialectReplace(dialect, sql, params)
 	return sql, params, err
 }
 
-// ToPgsql returns the sql placeholders with dollarsign format used by postgres.
-func (q *Query) ToPgsql() (string, []any, error) {
-	sql, params, err := q.toSql()
+// String returns the query with its parameters inlined, as with ToRaw.
+// This is meant for logging and debugging only, and should never be used to
+// execute the query. If the query has an error, the error is returned in
+// place of the sql.
+func (q *Query) String() string {
+	sql, err := q.ToRaw()
 	if err != nil {
-		return "", nil, err
+		return fmt.Sprintf("error: %v", err)
 	}
-	sql, err = dialectReplace(PGSQL, sql, params)
-	return sql, params, err
+	return sql
+}
+
+// ToMap returns the query built for dialect as a map with "sql", "args" and
+// "errors" keys, for structured logging. The errors are strings, and are
+// empty unless the query has an error, which is also returned.
+func (q *Query) ToMap(dialect Dialect) (map[string]any, error) {
+	sql, params, err := q.Sql(dialect)
+	errs := []string{}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, e := range joined.Unwrap() {
+			errs = append(errs, e.Error())
+		}
+	} else if err != nil {
+		errs = append(errs, err.Error())
+	}
+	return map[string]any{"sql": sql, "args": params, "errors": errs}, err
+}
+
+// ToMysql returns the sql placeholders with SQL (?) format used by MySQL
+func (q *Query) ToMysql() (string, []any, error) {
+	return q.Sql(MYSQL)
+}
+
+// ToMssql returns the sql placeholders with @p format used by SQL Server.
+func (q *Query) ToMssql() (string, []any, error) {
+	return q.Sql(MSSQL)
+}
+
+// ToOracle returns the sql placeholders with colon format (:1) used by Oracle.
+// Note: Oracle limits IN lists to 1000 elements, so very large slice
+// arguments should be split up before being passed in.
+func (q *Query) ToOracle() (string, []any, error) {
+	return q.Sql(ORACLE)
+}
+
+// ToPgsql returns the sql placeholders with dollarsign format used by postgres.
+func (q *Query) ToPgsql() (string, []any, error) {
+	return q.Sql(PGSQL)
 }
 
 // ToRaw returns a string which the parameters have been resolved added
 // as correctly as possible.
 func (q *Query) ToRaw() (string, error) {
-	sql, params, err := q.toSql()
-	if err != nil {
-		return "", err
-	}
-
-	sql, err = dialectReplace(RAW, sql, params)
+	sql, _, err := q.Sql(RAW)
 	return sql, err
 }
 
 // ToSql returns the placeholders with question (?) format used by most
 // databases such as sqlite, mysql, and others.
 func (q *Query) ToSql() (string, []any, error) {
-	sql, params, err := q.toSql()
-	if err != nil {
-		return "", nil, err
+	return q.Sql(SQL)
+}
+
+// Where adds a `WHERE expr` clause. The expr may be query text with args,
+// e.g. `Where("age > ?", 18)`, or a *Query such as `Where(Gt("age", 18))`.
+// An empty *Query adds nothing, and calling Where again right after adds
+// to the same clause, `WHERE (a = ?) AND (b = ?)`.
+func (q *Query) Where(expr any, args ...any) *Query {
+	return q.clause("WHERE", expr, args)
+}
+
+// With adds a common table expression, `WITH name AS (cte)`, to the start of
+// the query. Multiple CTEs are comma separated in the order they're added,
+// and their parameters come before those of the rest of the query.
+func (q *Query) With(name string, cte *Query) *Query {
+	if q == nil {
+		q = Q()
 	}
-	sql, err = dialectReplace(SQL, sql, params)
-	return sql, params, err
+	if cte == nil {
+		return q.addErr(fmt.Errorf("cannot use nil Query for CTE %v", name))
+	}
+	q.invalidate()
+	q.ctes = append(q.ctes, makePart(name+" AS (?)", cte))
+	return q
+}
+
+// WithRecursive is like With, but marks the CTEs as `WITH RECURSIVE`.
+func (q *Query) WithRecursive(name string, cte *Query) *Query {
+	q = q.With(name, cte)
+	q.recursive = true
+	return q
+}
+
+// addErr adds a part holding err, which is returned when the query is built.
+func (q *Query) addErr(err error) *Query {
+	if q == nil {
+		q = Q()
+	}
+	q.invalidate()
+	q.Parts = append(q.Parts, QueryPart{Errs: []error{err}})
+	return q
+}
+
+func (q *Query) addJoin(text string, args []any) *Query {
+	if q == nil {
+		q = Q()
+	}
+	q.invalidate()
+	q.markJoins()
+	q.joins = append(q.joins, makePart(text, args...))
+	return q
+}
+
+func (q *Query) addLockOption(option string) *Query {
+	if q == nil || q.lock == "" {
+		return q.addErr(fmt.Errorf("%v requires ForUpdate or ForShare", option))
+	}
+	q.invalidate()
+	q.lock += " " + option
+	return q
+}
+
+// body returns Parts with the joins inserted at joinsAt, which is the order
+// they're rendered in.
+func (q *Query) body() []QueryPart {
+	if len(q.joins) == 0 {
+		return q.Parts
+	}
+	at := len(q.Parts)
+	if q.joinsAt != nil && *q.joinsAt < at {
+		at = *q.joinsAt
+	}
+	body := make([]QueryPart, 0, len(q.Parts)+len(q.joins))
+	body = append(body, q.Parts[:at]...)
+	for i, j := range q.joins {
+		if at > 0 || i > 0 {
+			j.Text = " " + j.Text
+		}
+		body = append(body, j)
+	}
+	sep := true
+	for _, p := range q.Parts[at:] {
+		if sep && p.Text != "" {
+			// The first part has no separator when the joins came before it
+			if !strings.HasPrefix(p.Text, " ") {
+				p.Text = " " + p.Text
+			}
+			sep = false
+		}
+		body = append(body, p)
+	}
+	return body
+}
+
+// clause adds keyword followed by expr, which is either query text used with
+// args or a value bound as the only arg, such as a *Query. An empty *Query
+// adds nothing. When the last part added is a clause with the same keyword,
+// the conditions are each wrapped in parentheses and joined with AND.
+func (q *Query) clause(keyword string, expr any, args []any) *Query {
+	if cond, ok := expr.(*Query); ok && len(args) == 0 && cond.Empty() {
+		if q == nil {
+			return Q()
+		}
+		return q
+	}
+	text, ok := expr.(string)
+	if !ok {
+		text = "?"
+		args = append([]any{expr}, args...)
+	}
+
+	if q != nil && q.clauseKeyword == keyword && q.clauseEnd == len(q.Parts) && q.clauseEnd > 0 {
+		if q.clauseEnd-q.clauseStart == 1 {
+			first := &q.Parts[q.clauseStart]
+			first.Text = strings.Replace(first.Text, keyword+" ", keyword+" (", 1) + ")"
+		}
+		q.Space("AND ("+text+")", args...)
+		q.clauseEnd = len(q.Parts)
+		return q
+	}
+
+	if q == nil {
+		q = Q()
+	}
+	q.markJoins()
+	q = q.Space(keyword+" "+text, args...)
+	q.clauseKeyword, q.clauseStart, q.clauseEnd = keyword, len(q.Parts)-1, len(q.Parts)
+	return q
+}
+
+// cacheable returns true if the sql built for dialect only depends on the
+// query and not on its parameter values, so that Build can cache it.
+func cacheable(dialect Dialect) bool {
+	dialectsMu.RLock()
+	_, custom := dialects[dialect]
+	dialectsMu.RUnlock()
+	if custom {
+		return false
+	}
+	switch dialect {
+	case PGSQL, MYSQL, MSSQL, ORACLE, SQLITE, SQL, CLICKHOUSE, BIGQUERY, DUCKDB, COCKROACH, SNOWFLAKE, TRINO:
+		return true
+	default:
+		return false
+	}
+}
+
+func cloneParts(parts []QueryPart) []QueryPart {
+	if parts == nil {
+		return nil
+	}
+	clone := make([]QueryPart, len(parts))
+	for i, p := range parts {
+		clone[i] = QueryPart{
+			Text:   p.Text,
+			Params: append([]any(nil), p.Params...),
+			Errs:   append([]error(nil), p.Errs...),
+		}
+	}
+	return clone
+}
+
+// invalidate clears the sql cached by Build, since the query has changed.
+func (q *Query) invalidate() {
+	q.grouped, q.noConds = false, false
+	if cache, _ := q.cache.Load().(map[Dialect]string); len(cache) > 0 {
+		q.cache.Store(map[Dialect]string(nil))
+	}
+}
+
+func (q *Query) joinOn(kind string, table, on any, args []any) *Query {
+	if len(args) > 0 {
+		text, ok := on.(string)
+		if !ok {
+			return q.addErr(fmt.Errorf("%v args can only be used with a string ON condition", kind))
+		}
+		on = New(text, args...)
+	}
+	return q.addJoin(kind+" ? ON (?)", fragmentArgs([]any{table, on}))
+}
+
+// markJoins sets the position in Parts the joins are rendered at, unless an
+// earlier From, Where, Having or join has already set it.
+func (q *Query) markJoins() {
+	if q.joinsAt == nil {
+		at := len(q.Parts)
+		q.joinsAt = &at
+	}
+}
+
+func onConflict(cols []string) string {
+	if len(cols) == 0 {
+		return "ON CONFLICT"
+	}
+	return "ON CONFLICT (" + strings.Join(cols, ",") + ")"
+}
+
+func (q *Query) setLock(dialect Dialect, lock string) *Query {
+	if q == nil {
+		q = Q()
+	}
+	switch dialect {
+	case PGSQL, COCKROACH, MYSQL:
+	default:
+		return q.addErr(fmt.Errorf("%v is not supported by %v", lock, dialect))
+	}
+	q.invalidate()
+	q.lock = lock
+	return q
 }
 
 func (q *Query) toSql() (string, []any, error) {
 	if q == nil {
 		return "", nil, errors.New("cannot get sql on nil Query")
 	}
-	var sql string
+	var builder strings.Builder
 	var params []any
 
+	size, count := len(q.OptionalPrefix)+1, 0
+	for _, parts := range [][]QueryPart{q.prefixes, q.ctes, q.joins, q.Parts, q.suffixes} {
+		for _, p := range parts {
+			size += len(p.Text) + 1
+			count += len(p.Params)
+		}
+	}
+	builder.Grow(size)
+	if count > 0 {
+		params = make([]any, 0, count)
+	}
+
+	var errs []error
+	for _, p := range q.prefixes {
+		builder.WriteString(p.Text + " ")
+		params = append(params, p.Params...)
+		errs = append(errs, p.Errs...)
+	}
+
+	if len(q.ctes) > 0 {
+		builder.WriteString("WITH ")
+		if q.recursive {
+			builder.WriteString("RECURSIVE ")
+		}
+		for i, p := range q.ctes {
+			if i > 0 {
+				builder.WriteString(",")
+			}
+			builder.WriteString(p.Text)
+			params = append(params, p.Params...)
+			errs = append(errs, p.Errs...)
+		}
+		builder.WriteString(" ")
+	}
+
 	if q.OptionalPrefix != "" && len(q.Parts) > 0 {
-		sql = q.OptionalPrefix + " "
+		builder.WriteString(q.OptionalPrefix + " ")
 	}
 
-	for _, p := range q.Parts {
-		sql += p.Text
+	for _, p := range q.body() {
+		builder.WriteString(p.Text)
 		params = append(params, p.Params...)
+		errs = append(errs, p.Errs...)
+	}
+
+	if len(q.orders) > 0 {
+		builder.WriteString(" ORDER BY " + strings.Join(q.orders, ", "))
+	}
 
-		if len(p.Errs) != 0 {
-			return "", nil, errors.Join(p.Errs...)
+	if q.limit != nil || q.offset != nil {
+		// The dialect isn't known yet, so this is replaced in dialectReplace
+		limit, offset := -1, -1
+		if q.limit != nil {
+			limit = *q.limit
+		}
+		if q.offset != nil {
+			offset = *q.offset
 		}
+		fmt.Fprintf(&builder, " "+limitPh, limit, offset)
+	}
+
+	if q.lock != "" {
+		builder.WriteString(" " + q.lock)
+	}
+
+	for _, p := range q.suffixes {
+		builder.WriteString(" " + p.Text)
+		params = append(params, p.Params...)
+		errs = append(errs, p.Errs...)
+	}
+
+	if len(errs) != 0 {
+		return "", nil, errors.Join(errs...)
 	}
 
-	return strings.TrimSpace(sql), params, nil
+	return strings.TrimSpace(builder.String()), params, nil
 }
@@ -1,9 +1,12 @@
 package bqb
 
 import (
+	"database/sql"
 	"database/sql/driver"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -16,16 +19,233 @@ func TestArrays(t *testing.T) {
 	q := New("(?) (?) (?) (?) (?)", []string{"a", "b"}, []string{}, []*string{}, []int{1, 2}, []*int{})
 	sql, params, _ := q.ToSql()
 
-	if len(params) != 6 {
+	if len(params) != 7 {
 		t.Errorf("invalid params")
 	}
 
-	want := "(?,?) () (?) (?,?) (?)"
+	want := "(?,?) (?) (?) (?,?) (?)"
 	if sql != want {
 		t.Errorf("got: %q, want: %q", sql, want)
 	}
 }
 
+func TestArraysEmpty(t *testing.T) {
+	args := []any{
+		[]int{}, []int64{}, []*int{}, []bool{}, []float32{}, []float64{},
+		[]string{}, []*string{}, []time.Time{}, []any{}, []uint{},
+	}
+	for _, arg := range args {
+		sql, params, err := New("SELECT * FROM t WHERE id IN (?)", arg).ToPgsql()
+		if err != nil {
+			t.Errorf("%T got error: %v", arg, err)
+		}
+		want := "SELECT * FROM t WHERE id IN ($1)"
+		if sql != want {
+			t.Errorf("%T got: %q, want: %q", arg, sql, want)
+		}
+		if !reflect.DeepEqual(params, []any{nil}) {
+			t.Errorf("%T got unexpected params: %v", arg, params)
+		}
+	}
+}
+
+func TestArraysInt64(t *testing.T) {
+	q := New("id IN (?)", []int64{1, 2, 3})
+	sql, params, err := q.ToSql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+
+	want := "id IN (?,?,?)"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	wantP := []any{int64(1), int64(2), int64(3)}
+	if len(params) != len(wantP) {
+		t.Fatalf("got: %v, want: %v", params, wantP)
+	}
+	for i := range params {
+		if params[i] != wantP[i] {
+			t.Errorf("got: %v %T, want: %v %T", params[i], params[i], wantP[i], wantP[i])
+		}
+	}
+}
+
+func TestArraysBool(t *testing.T) {
+	q := New("flag IN (?)", []bool{true, false, true})
+	sql, params, err := q.ToSql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+
+	want := "flag IN (?,?,?)"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	if len(params) != 3 || params[0] != true || params[1] != false || params[2] != true {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	q = New("flag IN (?)", []bool{})
+	sql, params, _ = q.ToSql()
+	want = "flag IN (?)"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if len(params) != 1 || params[0] != nil {
+		t.Errorf("expected one nil param, got: %v", params)
+	}
+}
+
+func TestArraysFloat(t *testing.T) {
+	q := New("price IN (?) AND weight IN (?)", []float64{1.5, 2.5}, []float32{3.5})
+	sql, params, err := q.ToSql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+
+	want := "price IN (?,?) AND weight IN (?)"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	wantP := []any{1.5, 2.5, float32(3.5)}
+	if len(params) != len(wantP) {
+		t.Fatalf("got: %v, want: %v", params, wantP)
+	}
+	for i := range params {
+		if params[i] != wantP[i] {
+			t.Errorf("got: %v %T, want: %v %T", params[i], params[i], wantP[i], wantP[i])
+		}
+	}
+
+	q = New("price IN (?) AND weight IN (?)", []float64{}, []float32{})
+	sql, params, _ = q.ToSql()
+	want = "price IN (?) AND weight IN (?)"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if len(params) != 2 || params[0] != nil || params[1] != nil {
+		t.Errorf("expected two nil params, got: %v", params)
+	}
+}
+
+func TestArraysTime(t *testing.T) {
+	first := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	second := first.Add(time.Hour)
+
+	q := New("created_at IN (?)", []time.Time{first, second})
+	sql, params, err := q.ToSql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+
+	want := "created_at IN (?,?)"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	if len(params) != 2 || params[0] != first || params[1] != second {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	q = New("created_at IN (?)", []time.Time{})
+	sql, params, _ = q.ToSql()
+	want = "created_at IN (?)"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if len(params) != 1 || params[0] != nil {
+		t.Errorf("expected one nil param, got: %v", params)
+	}
+}
+
+type userID int
+
+func TestArraysReflect(t *testing.T) {
+	q := New("id IN (?) AND n IN (?) AND x IN (?)", []userID{1, 2}, []uint{3}, []userID{})
+	sql, params, err := q.ToSql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+
+	want := "id IN (?,?) AND n IN (?) AND x IN (?)"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	wantP := []any{userID(1), userID(2), uint(3), nil}
+	if len(params) != len(wantP) {
+		t.Fatalf("got: %v, want: %v", params, wantP)
+	}
+	for i := range params {
+		if params[i] != wantP[i] {
+			t.Errorf("got: %v %T, want: %v %T", params[i], params[i], wantP[i], wantP[i])
+		}
+	}
+}
+
+func TestArraysPointer(t *testing.T) {
+	ints := []int{1, 2}
+	ids := []userID{3}
+	var strs *[]string
+
+	q := New("a IN (?) AND b IN (?) AND c IN (?)", &ints, &ids, strs)
+	sql, params, err := q.ToSql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+
+	want := "a IN (?,?) AND b IN (?) AND c IN (?)"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	wantP := []any{1, 2, userID(3), nil}
+	if !reflect.DeepEqual(params, wantP) {
+		t.Errorf("got: %v, want: %v", params, wantP)
+	}
+}
+
+func TestArraysBytes(t *testing.T) {
+	q := New("data = ?", []byte("abc"))
+	sql, params, err := q.ToSql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+
+	want := "data = ?"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	if len(params) != 1 || string(params[0].([]byte)) != "abc" {
+		t.Errorf("expected []byte to be a single param, got: %v", params)
+	}
+}
+
+func TestArraysFixedSize(t *testing.T) {
+	id := [16]byte{0: 0xde, 15: 0xef}
+
+	q := New("n IN (?) AND id = ?", [3]int{1, 2, 3}, id)
+	sql, params, err := q.ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+
+	want := "n IN ($1,$2,$3) AND id = $4"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	wantP := []any{1, 2, 3, id[:]}
+	if !reflect.DeepEqual(params, wantP) {
+		t.Errorf("got: %v, want: %v", params, wantP)
+	}
+}
+
 func TestJson(t *testing.T) {
 	sql, _ := New(
 		"INSERT INTO my_table (json_map,json_list) VALUES (?,?)",
@@ -119,6 +339,61 @@ func TestJsonPointer(t *testing.T) {
 
 }
 
+func TestJsonRawMessage(t *testing.T) {
+	doc := json.RawMessage(`{"name":"O'Brien","tags":[1,2]}`)
+	var nilDoc json.RawMessage
+
+	q := New("INSERT INTO foo (doc, other) VALUES (?, ?) AND id IN (?)", doc, nilDoc,
+		[]json.RawMessage{json.RawMessage(`1`), json.RawMessage(`"a"`)})
+	sql, params, err := q.ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "INSERT INTO foo (doc, other) VALUES ($1, $2) AND id IN ($3,$4)"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	wantP := []any{`{"name":"O'Brien","tags":[1,2]}`, nil, `1`, `"a"`}
+	if !reflect.DeepEqual(params, wantP) {
+		t.Errorf("got: %v, want: %v", params, wantP)
+	}
+
+	sql, err = New("doc = ?", doc).ToRaw()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want = `doc = '{"name":"O''Brien","tags":[1,2]}'`
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+}
+
+func TestComposeNumbering(t *testing.T) {
+	outer := "SELECT * FROM users WHERE a = ? AND b = ? AND id IN (?)"
+	fragment := New("SELECT user_id FROM orders WHERE total > ? AND status = ?", 100, "paid")
+	want := "SELECT * FROM users WHERE a = $1 AND b = $2 AND id IN " +
+		"(SELECT user_id FROM orders WHERE total > $3 AND status = $4)"
+
+	// Fragments passed as arguments are numbered when the whole query is built
+	sql, params, err := New(outer, 1, 2, fragment).ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{1, 2, 100, "paid"}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	// Sql composed by hand from ToSql output is numbered by Rebind
+	fragmentSql, _, _ := fragment.ToSql()
+	composed := strings.Replace(outer, "(?)", "("+fragmentSql+")", 1)
+	if got := Rebind(PGSQL, composed); got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+}
+
 func TestErrorSubquery(t *testing.T) {
 	// One more ? than we are passing args for
 	subQuery := New("SELECT id FROM table2 WHERE id = ? and value = ?", 1)
@@ -164,6 +439,71 @@ func TestOptional(t *testing.T) {
 	}
 }
 
+func TestBuild(t *testing.T) {
+	sql, params, err := Build(PGSQL, "x IN (?)", []int{1, 2, 3})
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	if sql != "x IN ($1,$2,$3)" {
+		t.Errorf("got: %q, want: %q", sql, "x IN ($1,$2,$3)")
+	}
+	if !reflect.DeepEqual(params, []any{1, 2, 3}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	sql, _, err = Build(RAW, "x IN (?)", []int{1, 2, 3})
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	if sql != "x IN (1,2,3)" {
+		t.Errorf("got: %q, want: %q", sql, "x IN (1,2,3)")
+	}
+
+	_, _, err = Build(PGSQL, "x = ? AND y = ?", 1)
+	if err == nil {
+		t.Error("expected an error for a missing arg")
+	}
+}
+
+func TestNewNamed(t *testing.T) {
+	q := NewNamed(
+		"SELECT * FROM t WHERE (id = :id OR parent_id = :id) AND name IN (:names) AND created::date > ':skip'",
+		map[string]any{"id": 7, "names": []string{"a", "b"}},
+	)
+
+	sql, params, err := q.ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "SELECT * FROM t WHERE (id = $1 OR parent_id = $2) AND name IN ($3,$4) AND created::date > ':skip'"
+	if sql != want {
+		t.Errorf("\n got: %q\nwant: %q", sql, want)
+	}
+	wantP := []any{7, 7, "a", "b"}
+	if !reflect.DeepEqual(params, wantP) {
+		t.Errorf("got: %v, want: %v", params, wantP)
+	}
+
+	sql, params, _ = q.ToMysql()
+	want = "SELECT * FROM t WHERE (id = ? OR parent_id = ?) AND name IN (?,?) AND created::date > ':skip'"
+	if sql != want {
+		t.Errorf("\n got: %q\nwant: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, wantP) {
+		t.Errorf("got: %v, want: %v", params, wantP)
+	}
+
+	_, _, err = NewNamed("id = :id", map[string]any{}).ToSql()
+	if err == nil || !strings.Contains(err.Error(), "missing named parameter") {
+		t.Errorf("expected missing named parameter error, got: %v", err)
+	}
+
+	_, _, err = NewNamed("id = :id", map[string]any{"id": 1, "other": 2}).ToSql()
+	if err == nil || !strings.Contains(err.Error(), "unused named parameter") {
+		t.Errorf("expected unused named parameter error, got: %v", err)
+	}
+}
+
 func TestNils(t *testing.T) {
 	var q *Query
 	_, _, err := q.ToSql()
@@ -186,6 +526,16 @@ func TestNils(t *testing.T) {
 		t.Errorf("expected error for ToPgsql")
 	}
 
+	_, _, err = q.ToMssql()
+	if err == nil {
+		t.Errorf("expected error for ToMssql")
+	}
+
+	_, _, err = q.ToOracle()
+	if err == nil {
+		t.Errorf("expected error for ToOracle")
+	}
+
 	var qNil *Query
 	qNil.And("test")
 	_, _, err = qNil.ToSql()
@@ -244,6 +594,89 @@ func TestParamsExtra(t *testing.T) {
 	}
 }
 
+func TestParamsExtraPosition(t *testing.T) {
+	tests := []struct {
+		q    *Query
+		want string
+	}{
+		{
+			New("SELECT * FROM users WHERE a = ? AND b ?? 'k' AND c = ? AND d = ?", 1, 2),
+			`at offset 63 near " c = ? AND d = ?"`,
+		},
+		{
+			New("name = ? AND ünïcode = ?", "a"),
+			`at offset 23 near " AND ünïcode = ?"`,
+		},
+		{
+			New("x = ? AND y = ?", []int{1, 2}),
+			`at offset 14 near "x = ? AND y = ?"`,
+		},
+	}
+
+	for _, tt := range tests {
+		err := tt.q.Err()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("got: %v, want error containing: %v", err, tt.want)
+		}
+	}
+
+	err := New("a = ?", 1, 2, 3).Err()
+	if err == nil || !strings.Contains(err.Error(), "(3 args), 2 more args than placeholders") {
+		t.Errorf("got unexpected error: %v", err)
+	}
+}
+
+func TestParamsNoPanic(t *testing.T) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf("invalid input should return an error, got panic: %v", r)
+		}
+	}()
+
+	// A bare ? with no args is reported as an error when the query is built
+	_, _, err := New("SELECT * FROM t WHERE a = ?").ToSql()
+	if err == nil || !strings.Contains(err.Error(), "extra ? in text") {
+		t.Errorf("expected error for bare ?, got: %v", err)
+	}
+
+	// Unsupported types are reported as an error by ToRaw
+	_, err = New("a = ?", struct{}{}).ToRaw()
+	if err == nil || !strings.Contains(err.Error(), "unsupported type") {
+		t.Errorf("expected error for unsupported type, got: %v", err)
+	}
+
+	// NullString.Value has a value receiver, so a nil pointer is bound as NULL
+	// rather than calling it
+	_, params, err := New("a = ?", (*sql.NullString)(nil)).ToSql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	if len(params) != 1 || params[0] != nil {
+		t.Errorf("got unexpected params: %v", params)
+	}
+}
+
+func TestQuery_Err(t *testing.T) {
+	if err := New("a = ? AND b = ?", 1, 2).Err(); err != nil {
+		t.Errorf("got unexpected error: %v", err)
+	}
+
+	err := New("a = ? AND b = ?", 1).Err()
+	if err == nil || !strings.Contains(err.Error(), "extra ? in text: a = ? AND b = ? (1 args)") {
+		t.Errorf("expected error for too few args, got: %v", err)
+	}
+
+	err = New("a = ?", 1).And("b = ?", 2, 3).Err()
+	if err == nil || !strings.Contains(err.Error(), "missing ? in text:  AND b = ? (2 args)") {
+		t.Errorf("expected error for too many args, got: %v", err)
+	}
+
+	var qNil *Query
+	if qNil.Err() == nil {
+		t.Errorf("expected error for nil Query")
+	}
+}
+
 func TestParamsFunc(t *testing.T) {
 	q := New("?", func(x int) int { return x })
 	sql, err := q.ToRaw()
@@ -273,6 +706,28 @@ func TestParamsInterfaceList(t *testing.T) {
 	}
 }
 
+func TestParamsLiteral(t *testing.T) {
+	// New is already the escape hatch for trusted sql: the text is used as
+	// is apart from its ? placeholders, and never panics on a mismatch.
+	q := New("SELECT * FROM events WHERE created_at > now() - interval ? day", 7)
+	sql, params, err := q.ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "SELECT * FROM events WHERE created_at > now() - interval $1 day"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{7}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	_, _, err = New("now() - interval ? day").ToPgsql()
+	if err == nil {
+		t.Errorf("no error for ? without a param")
+	}
+}
+
 func TestParamsMissing(t *testing.T) {
 	q := New("params ?", 1, 2)
 	_, _, err := q.ToSql()
@@ -317,6 +772,60 @@ func TestQuery_And(t *testing.T) {
 	}
 }
 
+func TestQuery_AndIf(t *testing.T) {
+	for _, filter := range []bool{true, false} {
+		where := Optional("WHERE").
+			AndIf(filter, "name = ?", "a").
+			AndIf(true, "age > ?", 21).
+			OrIf(filter, "admin").
+			OrIf(false, "never")
+
+		sql, params, _ := New("SELECT * FROM t ?", where).ToSql()
+		want := "SELECT * FROM t WHERE age > ?"
+		wantP := []any{21}
+		if filter {
+			want = "SELECT * FROM t WHERE name = ? AND age > ? OR admin"
+			wantP = []any{"a", 21}
+		}
+		if sql != want {
+			t.Errorf("got: %q, want: %q", sql, want)
+		}
+		if !reflect.DeepEqual(params, wantP) {
+			t.Errorf("got: %v, want: %v", params, wantP)
+		}
+	}
+
+	sql, _, _ := New("SELECT * FROM t ?", Optional("WHERE").AndIf(false, "a")).ToSql()
+	if sql != "SELECT * FROM t" {
+		t.Errorf("got unexpected sql: %q", sql)
+	}
+}
+
+func TestQuery_Clone(t *testing.T) {
+	// Extra capacity means an append on a shallow copy would share the array
+	base := &Query{Parts: make([]QueryPart, 0, 10), OptionalPrefix: "WHERE"}
+	base.And("a = ?", 1).Limit(5)
+
+	clone := base.Clone()
+	clone.And("b = ?", 2).Limit(10)
+	clone.Parts[0].Params[0] = 3
+
+	sql, params, _ := base.ToSql()
+	if sql != "WHERE a = ? LIMIT 5" || !reflect.DeepEqual(params, []any{1}) {
+		t.Errorf("original changed: %q %v", sql, params)
+	}
+
+	sql, params, _ = clone.ToSql()
+	if sql != "WHERE a = ? AND b = ? LIMIT 10" || !reflect.DeepEqual(params, []any{3, 2}) {
+		t.Errorf("got unexpected clone: %q %v", sql, params)
+	}
+
+	var qNil *Query
+	if qNil.Clone() != nil {
+		t.Errorf("expected nil clone of nil Query")
+	}
+}
+
 func TestQuery_Comma(t *testing.T) {
 	q := New("a")
 	q.Comma("b")
@@ -343,6 +852,40 @@ func TestQuery_Concat(t *testing.T) {
 	}
 }
 
+func TestQuery_CountQuery(t *testing.T) {
+	q := New("SELECT id,name FROM users WHERE age > ? AND name LIKE ? ORDER BY name", 21, "a%").
+		Limit(10).Offset(20)
+
+	sql, params, err := q.CountQuery().ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "SELECT COUNT(*) FROM (SELECT id,name FROM users WHERE age > $1 AND name LIKE $2 ORDER BY name) count_query"
+	if sql != want {
+		t.Errorf("\n got: %q\nwant: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{21, "a%"}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	sql, _, _ = q.ToPgsql()
+	if !strings.HasSuffix(sql, "LIMIT 10 OFFSET 20") {
+		t.Errorf("CountQuery should not change the original query: %q", sql)
+	}
+
+	// Oracle doesn't allow AS before a table alias
+	sql, _, _ = q.CountQuery().ToOracle()
+	want = "SELECT COUNT(*) FROM (SELECT id,name FROM users WHERE age > :1 AND name LIKE :2 ORDER BY name) count_query"
+	if sql != want {
+		t.Errorf("\n got: %q\nwant: %q", sql, want)
+	}
+
+	var qNil *Query
+	if _, _, err := qNil.CountQuery().ToSql(); err == nil {
+		t.Errorf("expected error for nil Query")
+	}
+}
+
 func TestQuery_Empty(t *testing.T) {
 	child := Optional("EMPTY")
 	parent := New("?", child)
@@ -353,6 +896,135 @@ func TestQuery_Empty(t *testing.T) {
 	}
 }
 
+func TestQuery_Distinct(t *testing.T) {
+	for _, dialect := range []Dialect{PGSQL, MYSQL, SQLITE, MSSQL} {
+		sql, _, err := New("SELECT").Distinct().Space("name FROM users").Sql(dialect)
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		want := "SELECT DISTINCT name FROM users"
+		if sql != want {
+			t.Errorf("%v got: %q, want: %q", dialect, sql, want)
+		}
+	}
+
+	sql, params, err := New("SELECT").DistinctOn(PGSQL, "user_id", "day").
+		Space("* FROM logins WHERE day > ?", "2023-01-01").ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "SELECT DISTINCT ON (user_id, day) * FROM logins WHERE day > $1"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{"2023-01-01"}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	_, _, err = New("SELECT").DistinctOn(MYSQL, "user_id").Space("* FROM logins").ToMysql()
+	if err == nil || err.Error() != "DISTINCT ON is not supported by mysql" {
+		t.Errorf("got unexpected error: %v", err)
+	}
+
+	_, _, err = New("SELECT").DistinctOn(PGSQL).Space("* FROM logins").ToPgsql()
+	if err == nil || err.Error() != "DISTINCT ON requires columns" {
+		t.Errorf("got unexpected error: %v", err)
+	}
+}
+
+func TestQuery_Joins(t *testing.T) {
+	q := New("SELECT * FROM users u").
+		LeftJoin("orders o", New("o.user_id = u.id AND o.total > ?", 100)).
+		Space("WHERE u.age > ?", 21)
+
+	sql, params, err := q.ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "SELECT * FROM users u LEFT JOIN orders o ON (o.user_id = u.id AND o.total > $1) WHERE u.age > $2"
+	if sql != want {
+		t.Errorf("\n got: %q\nwant: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{100, 21}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	// Joins are rendered after FROM and before WHERE whatever the call order,
+	// with their parameters in the same order
+	sub := New("(SELECT user_id, COUNT(*) AS n FROM logins WHERE day > ? GROUP BY user_id) l", "2023-01-01")
+	q = New("SELECT *").From("users", "u").
+		Where("u.id = ?", 5).
+		InnerJoin(sub, "l.user_id = u.id").
+		RightJoin("teams t", "t.id = u.team_id AND t.size > ?", 3).
+		Where("u.age > ?", 21).
+		CrossJoin("settings")
+
+	sql, params, _ = New("?", q).ToPgsql()
+	want = "SELECT * FROM users u " +
+		"INNER JOIN (SELECT user_id, COUNT(*) AS n FROM logins WHERE day > $1 GROUP BY user_id) l ON (l.user_id = u.id) " +
+		"RIGHT JOIN teams t ON (t.id = u.team_id AND t.size > $2) CROSS JOIN settings " +
+		"WHERE (u.id = $3) AND (u.age > $4)"
+	if sql != want {
+		t.Errorf("\n got: %q\nwant: %q", sql, want)
+	}
+	wantParams := []any{"2023-01-01", 3, 5, 21}
+	if !reflect.DeepEqual(params, wantParams) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+	if args, _ := q.Args(PGSQL); !reflect.DeepEqual(args, wantParams) {
+		t.Errorf("got unexpected args: %v", args)
+	}
+
+	sql, _, _ = q.Clone().CrossJoin("flags").ToPgsql()
+	if !strings.Contains(sql, "CROSS JOIN settings CROSS JOIN flags WHERE") {
+		t.Errorf("got unexpected sql from clone: %q", sql)
+	}
+	sql, params, _ = q.CountQuery().ToPgsql()
+	if !strings.HasPrefix(sql, "SELECT COUNT(*) FROM (SELECT * FROM users u INNER JOIN") ||
+		!reflect.DeepEqual(params, wantParams) {
+		t.Errorf("got unexpected count query: %q %v", sql, params)
+	}
+
+	// Without From, joins go before the first Where
+	q = New("SELECT * FROM users u").Where("u.id = ?", 5).LeftJoin("teams t", "t.id = u.team_id")
+	sql, _, _ = q.ToSql()
+	want = "SELECT * FROM users u LEFT JOIN teams t ON (t.id = u.team_id) WHERE u.id = ?"
+	if sql != want {
+		t.Errorf("\n got: %q\nwant: %q", sql, want)
+	}
+
+	sql, _, _ = q.Reset().Space("SELECT 1").ToSql()
+	if sql != "SELECT 1" {
+		t.Errorf("got unexpected sql after Reset: %q", sql)
+	}
+}
+
+func TestQuery_JoinsArgs(t *testing.T) {
+	withArgs := New("SELECT * FROM users u").
+		LeftJoin("orders o", "o.user_id = u.id AND o.total > ?", 100).
+		InnerJoin("teams t", "t.id = u.team_id AND t.name IN (?)", []string{"a", "b"})
+	withQuery := New("SELECT * FROM users u").
+		LeftJoin("orders o", New("o.user_id = u.id AND o.total > ?", 100)).
+		InnerJoin("teams t", New("t.id = u.team_id AND t.name IN (?)", []string{"a", "b"}))
+
+	sql, params, err := withArgs.ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	wantSql, wantParams, _ := withQuery.ToPgsql()
+	if sql != wantSql {
+		t.Errorf("\n got: %q\nwant: %q", sql, wantSql)
+	}
+	if !reflect.DeepEqual(params, wantParams) {
+		t.Errorf("got: %v, want: %v", params, wantParams)
+	}
+
+	_, _, err = New("SELECT * FROM users u").LeftJoin("orders o", New("o.user_id = u.id"), 1).ToPgsql()
+	if err == nil {
+		t.Error("expected an error for args with a *Query condition")
+	}
+}
+
 func TestQuery_Len(t *testing.T) {
 	q := Optional("a")
 	if q.Len() != 0 {
@@ -373,6 +1045,166 @@ func TestQuery_Len(t *testing.T) {
 	}
 }
 
+func TestQuery_Limit(t *testing.T) {
+	q := New("SELECT * FROM t WHERE a = ? ORDER BY id", 1).Limit(10).Offset(20)
+
+	tests := map[Dialect]string{
+		PGSQL:  "SELECT * FROM t WHERE a = $1 ORDER BY id LIMIT 10 OFFSET 20",
+		MYSQL:  "SELECT * FROM t WHERE a = ? ORDER BY id LIMIT 10 OFFSET 20",
+		MSSQL:  "SELECT * FROM t WHERE a = @p1 ORDER BY id OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY",
+		ORACLE: "SELECT * FROM t WHERE a = :1 ORDER BY id OFFSET 20 ROWS FETCH NEXT 10 ROWS ONLY",
+		RAW:    "SELECT * FROM t WHERE a = 1 ORDER BY id LIMIT 10 OFFSET 20",
+	}
+	for dialect, want := range tests {
+		sql, _, err := q.Sql(dialect)
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		if sql != want {
+			t.Errorf("\n got: %q\nwant: %q", sql, want)
+		}
+	}
+
+	sub := New("SELECT id FROM t ORDER BY id").Limit(5)
+	sql, _, _ := New("SELECT * FROM u WHERE id IN (?)", sub).ToMssql()
+	want := "SELECT * FROM u WHERE id IN (SELECT id FROM t ORDER BY id OFFSET 0 ROWS FETCH NEXT 5 ROWS ONLY)"
+	if sql != want {
+		t.Errorf("\n got: %q\nwant: %q", sql, want)
+	}
+
+	offsetOnly := map[Dialect]string{
+		PGSQL:  "SELECT * FROM t OFFSET 5",
+		MYSQL:  "SELECT * FROM t LIMIT 18446744073709551615 OFFSET 5",
+		SQLITE: "SELECT * FROM t LIMIT -1 OFFSET 5",
+		MSSQL:  "SELECT * FROM t OFFSET 5 ROWS",
+	}
+	for dialect, want := range offsetOnly {
+		sql, _, _ := New("SELECT * FROM t").Offset(5).Sql(dialect)
+		if sql != want {
+			t.Errorf("got: %q, want: %q", sql, want)
+		}
+	}
+
+	sql, _, _ = New("SELECT * FROM t").ToPgsql()
+	if sql != "SELECT * FROM t" {
+		t.Errorf("got unexpected sql without limit: %q", sql)
+	}
+
+	var qNil *Query
+	if _, _, err := qNil.Limit(-1).ToSql(); err == nil {
+		t.Errorf("expected error for negative limit")
+	}
+	if _, _, err := qNil.Offset(-1).ToSql(); err == nil {
+		t.Errorf("expected error for negative offset")
+	}
+}
+
+func TestQuery_MustSql(t *testing.T) {
+	sql, params := New("a = ?", 1).MustSql(PGSQL)
+	if sql != "a = $1" || len(params) != 1 {
+		t.Errorf("got unexpected sql: %q, params: %v", sql, params)
+	}
+
+	bad := New("a = ?").And("b = ?", 1, 2)
+	_, _, err := bad.Sql(PGSQL)
+	if err == nil {
+		t.Fatalf("expected error from Sql")
+	}
+	if !strings.Contains(err.Error(), "extra ?") || !strings.Contains(err.Error(), "missing ?") {
+		t.Errorf("expected errors from every part, got: %v", err)
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expected MustSql to panic")
+		}
+	}()
+	bad.MustSql(PGSQL)
+}
+
+func TestQuery_NamedArgs(t *testing.T) {
+	q := New("SELECT * FROM users WHERE id IN (?) AND name = ?", []int{7, 8}, "joe")
+	wantP := []any{sql.Named("p1", 7), sql.Named("p2", 8), sql.Named("p3", "joe")}
+
+	sql, params, err := q.NamedArgs(MSSQL)
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "SELECT * FROM users WHERE id IN (@p1,@p2) AND name = @p3"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, wantP) {
+		t.Errorf("got: %v, want: %v", params, wantP)
+	}
+
+	_, _, err = q.NamedArgs(PGSQL)
+	if err == nil {
+		t.Error("expected an error for an unsupported dialect")
+	}
+}
+
+func TestQuery_OnConflict(t *testing.T) {
+	insert := func() *Query {
+		return New("INSERT INTO users (id,name,visits) VALUES (?,?,?)", 1, "a", 1)
+	}
+
+	sql, _, err := insert().OnConflictDoNothing("id").ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "INSERT INTO users (id,name,visits) VALUES ($1,$2,$3) ON CONFLICT (id) DO NOTHING"
+	if sql != want {
+		t.Errorf("\n got: %q\nwant: %q", sql, want)
+	}
+
+	sql, params, err := insert().OnConflictDoUpdate(
+		[]string{"id"},
+		Set("name", New("EXCLUDED.name")),
+		Set("visits", 2),
+	).ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want = "INSERT INTO users (id,name,visits) VALUES ($1,$2,$3) " +
+		"ON CONFLICT (id) DO UPDATE SET name = EXCLUDED.name,visits = $4"
+	if sql != want {
+		t.Errorf("\n got: %q\nwant: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{1, "a", 1, 2}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	sql, params, err = insert().OnDuplicateKeyUpdate(
+		Set("name", New("VALUES(name)")),
+		Set("visits", 2),
+	).ToMysql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want = "INSERT INTO users (id,name,visits) VALUES (?,?,?) " +
+		"ON DUPLICATE KEY UPDATE name = VALUES(name),visits = ?"
+	if sql != want {
+		t.Errorf("\n got: %q\nwant: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{1, "a", 1, 2}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	sql, _, _ = insert().OnConflictDoNothing().ToSql()
+	if !strings.HasSuffix(sql, "ON CONFLICT DO NOTHING") {
+		t.Errorf("got unexpected sql: %q", sql)
+	}
+
+	var qNil *Query
+	if _, _, err = qNil.OnConflictDoUpdate(nil, Set("a", 1)).ToPgsql(); err == nil {
+		t.Errorf("expected error for missing conflict columns")
+	}
+	if _, _, err = qNil.OnDuplicateKeyUpdate().ToMysql(); err == nil {
+		t.Errorf("expected error for missing assignments")
+	}
+}
+
 func TestQuery_Or(t *testing.T) {
 	q := New("a")
 	q.Or("b")
@@ -385,6 +1217,44 @@ func TestQuery_Or(t *testing.T) {
 	}
 }
 
+func TestQuery_Returning(t *testing.T) {
+	q := New("INSERT INTO users (name) VALUES (?)", "a").Returning(PGSQL, "id", "created_at")
+	sql, params, err := q.ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := `INSERT INTO users (name) VALUES ($1) RETURNING "id","created_at"`
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if len(params) != 1 {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	sql, _, _ = New("DELETE FROM users").Returning(SQLITE, "*").ToSql()
+	want = "DELETE FROM users RETURNING *"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	sql, _, _ = New("UPDATE users t SET a = 1").Returning(PGSQL, "t.id", "t.*").ToPgsql()
+	want = `UPDATE users t SET a = 1 RETURNING "t"."id","t".*`
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	_, _, err = New("INSERT INTO users (name) VALUES (?)", "a").Returning(MYSQL, "id").ToMysql()
+	if err == nil || !strings.Contains(err.Error(), "RETURNING is not supported by mysql") {
+		t.Errorf("expected error for mysql, got: %v", err)
+	}
+
+	var qNil *Query
+	sql, _, _ = qNil.Returning(PGSQL, "id").ToPgsql()
+	if sql != `RETURNING "id"` {
+		t.Errorf("got unexpected sql: %q", sql)
+	}
+}
+
 func TestQuery_Space(t *testing.T) {
 	q := New("a")
 	q.Space("b")
@@ -396,6 +1266,29 @@ func TestQuery_Space(t *testing.T) {
 	}
 }
 
+func TestQuery_ToMap(t *testing.T) {
+	m, err := New("SELECT * FROM users WHERE id = ? AND name = ?", 7, "joe").ToMap(PGSQL)
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := map[string]any{
+		"sql":    "SELECT * FROM users WHERE id = $1 AND name = $2",
+		"args":   []any{7, "joe"},
+		"errors": []string{},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("got: %v, want: %v", m, want)
+	}
+
+	m, err = New("a = ? AND b = ?", 1).Space("c = ?").ToMap(PGSQL)
+	if err == nil {
+		t.Error("expected an error")
+	}
+	if errs := m["errors"].([]string); len(errs) != 2 {
+		t.Errorf("got errors: %q, want 2", errs)
+	}
+}
+
 func TestQuery_ToMysql(t *testing.T) {
 	q := New("SELECT * FROM table WHERE a = ? AND b = ?", 1, "b")
 	sql, params, _ := q.ToMysql()
@@ -409,6 +1302,41 @@ func TestQuery_ToMysql(t *testing.T) {
 	}
 }
 
+func TestQuery_String(t *testing.T) {
+	q := New("SELECT * FROM t WHERE name = ? AND id IN (?)", "it's", []int{1, 2})
+	want := "SELECT * FROM t WHERE name = 'it''s' AND id IN (1,2)"
+	if q.String() != want {
+		t.Errorf("got: %q, want: %q", q.String(), want)
+	}
+
+	if got := fmt.Sprint(q); got != want {
+		t.Errorf("got: %q, want: %q", got, want)
+	}
+
+	sub, _, _ := New("a IN (?)", q).ToSql()
+	if sub != "a IN (SELECT * FROM t WHERE name = ? AND id IN (?,?))" {
+		t.Errorf("subquery should not be rendered with String(): %q", sub)
+	}
+
+	got := New("a = ?").String()
+	if !strings.HasPrefix(got, "error: extra ? in text") {
+		t.Errorf("got unexpected String() for invalid query: %q", got)
+	}
+}
+
+func TestQuery_ToMssql(t *testing.T) {
+	q := New("SELECT * FROM table WHERE a = ? AND b ?? c AND d IN (?)", 1, []string{"e", "f"})
+	sql, params, _ := q.ToMssql()
+	if len(params) != 3 {
+		t.Errorf("expected three parameters, got %v", len(params))
+	}
+
+	want := "SELECT * FROM table WHERE a = @p1 AND b ? c AND d IN (@p2,@p3)"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+}
+
 func TestQuery_ToMysqlTime(t *testing.T) {
 	var names []string
 	for i := 0; i < 10000; i++ {
@@ -438,6 +1366,19 @@ func TestQuery_ToMysqlTime(t *testing.T) {
 
 }
 
+func TestQuery_ToOracle(t *testing.T) {
+	q := New("SELECT * FROM table WHERE a = ? AND b ?? c AND d = ?", 1, "d")
+	sql, params, _ := q.ToOracle()
+	if len(params) != 2 {
+		t.Errorf("expected two parameters, got %v", len(params))
+	}
+
+	want := "SELECT * FROM table WHERE a = :1 AND b ? c AND d = :2"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+}
+
 func TestQuery_ToPgsql(t *testing.T) {
 	q := New("SELECT name,").
 		Space("(SELECT * FROM other_table WHERE name = ?) as other_name", "test").
@@ -517,26 +1458,161 @@ func TestQuery_ToSql(t *testing.T) {
 	}
 }
 
-func TestQueryBuilding(t *testing.T) {
-	sel := Optional("SELECT")
-
-	sel.Comma("name")
-	sel.Comma("id")
-
-	from := Optional("FROM")
-	from.Space("my_table")
+func TestQuery_Where(t *testing.T) {
+	tests := []struct {
+		got, want *Query
+	}{
+		{New("SELECT * FROM users").Where("age > ? AND name = ?", 18, "joe"),
+			New("SELECT * FROM users").Where(New("age > ? AND name = ?", 18, "joe"))},
+		{New("SELECT * FROM users").Where("age > ?", 18),
+			New("SELECT * FROM users").Where(Gt("age", 18))},
+	}
 
-	where := Optional("WHERE")
+	for _, tt := range tests {
+		sql, params, err := tt.got.ToPgsql()
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		wantSql, wantParams, _ := tt.want.ToPgsql()
+		if sql != wantSql {
+			t.Errorf("got: %q, want: %q", sql, wantSql)
+		}
+		if !reflect.DeepEqual(params, wantParams) {
+			t.Errorf("got: %v, want: %v", params, wantParams)
+		}
+	}
 
-	adultCond := Q()
-	adultCond.And("name = ?", "adult")
-	adultCond.And("age > ?", 20)
+	sql, _, _ := New("SELECT * FROM users").Where("age > ?", 18).ToPgsql()
+	if sql != "SELECT * FROM users WHERE age > $1" {
+		t.Errorf("got: %q", sql)
+	}
+
+	joined := []struct {
+		q      *Query
+		want   string
+		params []any
+	}{
+		{
+			New("SELECT * FROM users").Where("a = ? OR b = ?", 1, 2).Where(Eq("c", 3)).Where("d = ?", 4),
+			"SELECT * FROM users WHERE (a = $1 OR b = $2) AND (c = $3) AND (d = $4)",
+			[]any{1, 2, 3, 4},
+		},
+		{
+			New("SELECT * FROM users").Where(Optional("")).Where(Q()),
+			"SELECT * FROM users",
+			nil,
+		},
+		{
+			New("SELECT * FROM users").Where(Optional("")).Where("a = ?", 1),
+			"SELECT * FROM users WHERE a = $1",
+			[]any{1},
+		},
+		{
+			New("SELECT team FROM users").Where("a = ?", 1).Space("GROUP BY team").
+				Having("COUNT(*) > ?", 5).Having("MAX(age) < ?", 30),
+			"SELECT team FROM users WHERE a = $1 GROUP BY team HAVING (COUNT(*) > $2) AND (MAX(age) < $3)",
+			[]any{1, 5, 30},
+		},
+		{
+			New("SELECT * FROM users").Where("a = ?", 1).Space("UNION SELECT * FROM admins").Where("b = ?", 2),
+			"SELECT * FROM users WHERE a = $1 UNION SELECT * FROM admins WHERE b = $2",
+			[]any{1, 2},
+		},
+	}
+	for _, tt := range joined {
+		sql, params, err := tt.q.ToPgsql()
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		if sql != tt.want {
+			t.Errorf("\n got: %q\nwant: %q", sql, tt.want)
+		}
+		if !reflect.DeepEqual(params, tt.params) {
+			t.Errorf("got: %v, want: %v", params, tt.params)
+		}
+	}
 
-	if len(adultCond.Parts) > 0 {
-		where.And("(?)", adultCond)
+	base := New("SELECT * FROM users").Where("a = ?", 1)
+	clone := base.Clone().Where("b = ?", 2)
+	sql, _, _ = base.ToPgsql()
+	if sql != "SELECT * FROM users WHERE a = $1" {
+		t.Errorf("Where on a clone changed the original: %q", sql)
+	}
+	sql, _, _ = clone.ToPgsql()
+	if sql != "SELECT * FROM users WHERE (a = $1) AND (b = $2)" {
+		t.Errorf("got: %q", sql)
 	}
+}
 
-	where.Or("(name = ? AND age < ?)", "youth", 21)
+func TestQuery_With(t *testing.T) {
+	q := New("SELECT * FROM recent WHERE id > ?", 3).
+		With("recent", New("SELECT * FROM orders WHERE created > ?", "2023-01-01"))
+
+	sql, params, err := q.ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "WITH recent AS (SELECT * FROM orders WHERE created > $1) SELECT * FROM recent WHERE id > $2"
+	if sql != want {
+		t.Errorf("\n got: %q\nwant: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{"2023-01-01", 3}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	q = New("SELECT * FROM a JOIN b USING (id)").
+		With("a", New("SELECT id FROM x WHERE v = ?", 1)).
+		With("b", New("SELECT id FROM y WHERE v = ?", 2))
+	sql, params, _ = q.ToPgsql()
+	want = "WITH a AS (SELECT id FROM x WHERE v = $1),b AS (SELECT id FROM y WHERE v = $2) SELECT * FROM a JOIN b USING (id)"
+	if sql != want {
+		t.Errorf("\n got: %q\nwant: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{1, 2}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	tree := New("SELECT id FROM nodes WHERE id = ?", 1).
+		Space("UNION ALL SELECT n.id FROM nodes n JOIN tree t ON n.parent_id = t.id")
+	q = New("SELECT * FROM tree").WithRecursive("tree(id)", tree)
+	sql, _, _ = q.ToPgsql()
+	want = "WITH RECURSIVE tree(id) AS (SELECT id FROM nodes WHERE id = $1 " +
+		"UNION ALL SELECT n.id FROM nodes n JOIN tree t ON n.parent_id = t.id) SELECT * FROM tree"
+	if sql != want {
+		t.Errorf("\n got: %q\nwant: %q", sql, want)
+	}
+
+	sql, _, _ = q.Clone().CountQuery().ToPgsql()
+	if !strings.HasPrefix(sql, "SELECT COUNT(*) FROM (WITH RECURSIVE tree(id) AS") {
+		t.Errorf("got unexpected count query: %q", sql)
+	}
+
+	var qNil *Query
+	if _, _, err := qNil.With("a", nil).ToSql(); err == nil {
+		t.Errorf("expected error for nil CTE")
+	}
+}
+
+func TestQueryBuilding(t *testing.T) {
+	sel := Optional("SELECT")
+
+	sel.Comma("name")
+	sel.Comma("id")
+
+	from := Optional("FROM")
+	from.Space("my_table")
+
+	where := Optional("WHERE")
+
+	adultCond := Q()
+	adultCond.And("name = ?", "adult")
+	adultCond.And("age > ?", 20)
+
+	if len(adultCond.Parts) > 0 {
+		where.And("(?)", adultCond)
+	}
+
+	where.Or("(name = ? AND age < ?)", "youth", 21)
 
 	q := New("? ? ? LIMIT ?", sel, from, where, 10)
 
@@ -570,6 +1646,23 @@ func TestQueryLiteralQWrapped(t *testing.T) {
 	}
 }
 
+func TestQueryValue(t *testing.T) {
+	sub := New("SELECT id FROM teams WHERE name = ?", "a")
+	q := New("SELECT * FROM users WHERE team_id IN (?) AND age > ?", *sub, 21)
+
+	sql, params, err := q.ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "SELECT * FROM users WHERE team_id IN (SELECT id FROM teams WHERE name = $1) AND age > $2"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{"a", 21}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+}
+
 func TestQueryNil(t *testing.T) {
 	var q *Query
 	q2 := New("test ?", q)
@@ -692,6 +1785,67 @@ func TestValuer(t *testing.T) {
 	}
 }
 
+type defaultValuer struct{ s string }
+
+func (d *defaultValuer) Value() (driver.Value, error) {
+	// A pointer receiver can handle nil itself
+	if d == nil {
+		return "default", nil
+	}
+	return d.s, nil
+}
+
+func TestValuerNilPointer(t *testing.T) {
+	_, params, err := New("a = ? AND b = ?", (*defaultValuer)(nil), &defaultValuer{"b"}).ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	if want := []any{"default", "b"}; !reflect.DeepEqual(params, want) {
+		t.Errorf("got: %v, want: %v", params, want)
+	}
+
+	// uuidValuer.Value has a value receiver, so it can't be called on nil
+	_, params, _ = New("a = ?", (*uuidValuer)(nil)).ToPgsql()
+	if want := []any{nil}; !reflect.DeepEqual(params, want) {
+		t.Errorf("got: %v, want: %v", params, want)
+	}
+}
+
+type uuidValuer [2]byte
+
+func (u uuidValuer) Value() (driver.Value, error) {
+	return fmt.Sprintf("%x-%x", u[0], u[1]), nil
+}
+
+func TestValuerSlice(t *testing.T) {
+	ids := []uuidValuer{{0xab, 0x01}, {0xcd, 0x02}}
+	sql, params, err := New("id IN (?)", ids).ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	if want := "id IN ($1,$2)"; sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if want := []any{"ab-1", "cd-2"}; !reflect.DeepEqual(params, want) {
+		t.Errorf("got: %v, want: %v", params, want)
+	}
+
+	_, params, _ = New("id IN (?)", []*uuidValuer{&ids[0], nil}).ToPgsql()
+	if want := []any{"ab-1", nil}; !reflect.DeepEqual(params, want) {
+		t.Errorf("got: %v, want: %v", params, want)
+	}
+
+	_, params, _ = New("a IN (?)", []*defaultValuer{{"a"}, nil}).ToPgsql()
+	if want := []any{"a", "default"}; !reflect.DeepEqual(params, want) {
+		t.Errorf("got: %v, want: %v", params, want)
+	}
+
+	_, _, err = New("path IN (?)", []valuer{{"a"}, nil}).ToPgsql()
+	if err == nil || err.Error() != "error creating value" {
+		t.Errorf("got unexpected error: %v", err)
+	}
+}
+
 func TestValuerError(t *testing.T) {
 	var v valuer
 	q := New("?", v)
@@ -703,6 +1857,62 @@ func TestValuerError(t *testing.T) {
 	}
 }
 
+func TestValuerErrorNested(t *testing.T) {
+	var v valuer
+	wantError := "error creating value"
+
+	// Helpers build their parts with New, so errors from args, including
+	// driver.Valuer, are kept through any level of composition.
+	queries := []*Query{
+		New("SELECT * FROM t WHERE ?", In("path", v, valuer{"a"})),
+		New("SELECT * FROM t WHERE ?", Coalesce("a", v)),
+		New("SELECT * FROM t").Having(Eq("path", v)),
+		New("SELECT * FROM t WHERE ?", New("(?)", New("path = ?", v))),
+	}
+	for _, q := range queries {
+		if err := q.Err(); err == nil || err.Error() != wantError {
+			t.Errorf("got Err: %v, want: %q", err, wantError)
+		}
+		if _, _, err := q.ToPgsql(); err == nil || err.Error() != wantError {
+			t.Errorf("got ToPgsql error: %v, want: %q", err, wantError)
+		}
+	}
+}
+
+func TestValuerNullTypes(t *testing.T) {
+	q := New(
+		"a = ? AND b = ? AND c = ? AND d = ?",
+		sql.NullString{String: "x", Valid: true},
+		sql.NullString{String: "y"},
+		sql.NullInt64{Int64: 5, Valid: true},
+		sql.NullInt64{},
+	)
+
+	_, params, err := q.ToSql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+
+	wantP := []any{"x", nil, int64(5), nil}
+	if len(params) != len(wantP) {
+		t.Fatalf("got: %v, want: %v", params, wantP)
+	}
+	for i := range params {
+		if params[i] != wantP[i] {
+			t.Errorf("got: %v %T, want: %v %T", params[i], params[i], wantP[i], wantP[i])
+		}
+	}
+
+	raw, err := q.ToRaw()
+	if err != nil {
+		t.Errorf("got error from ToRaw(): %v", err)
+	}
+	want := "a = 'x' AND b = NULL AND c = 5 AND d = NULL"
+	if raw != want {
+		t.Errorf("got: %q, want: %q", raw, want)
+	}
+}
+
 func Benchmark_ToMysql_Params(b *testing.B) {
 	parts := []string{}
 	args := []any{}
@@ -762,3 +1972,446 @@ func Benchmark_ToRaw_Params(b *testing.B) {
 		}
 	}
 }
+
+func Benchmark_ToPgsql_InList(b *testing.B) {
+	ids := make([]int, 1000)
+	for i := range ids {
+		ids[i] = i
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, err := New("SELECT * FROM t WHERE a ?? 'k' AND id IN (?)", ids).ToPgsql()
+		if err != nil {
+			b.Fatalf("failed to make benchmark sql: %v", err)
+		}
+	}
+}
+
+func Benchmark_ToRaw_InList(b *testing.B) {
+	ids := make([]int, 1000)
+	for i := range ids {
+		ids[i] = i
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := New("SELECT * FROM t WHERE id IN (?)", ids).ToRaw()
+		if err != nil {
+			b.Fatalf("failed to make benchmark sql: %v", err)
+		}
+	}
+}
+
+func Benchmark_ToPgsql_Parts(b *testing.B) {
+	q := New("SELECT * FROM t WHERE")
+	for i := 0; i < 1000; i++ {
+		q.And("a = ?", i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, err := q.ToPgsql()
+		if err != nil {
+			b.Fatalf("failed to make benchmark sql: %v", err)
+		}
+	}
+}
+
+func TestQuery_Explain(t *testing.T) {
+	sel := func() *Query { return New("SELECT * FROM users WHERE id = ?", 7) }
+	tests := []struct {
+		q       *Query
+		dialect Dialect
+		want    string
+	}{
+		{sel().Explain(PGSQL, "ANALYZE"), PGSQL, "EXPLAIN ANALYZE SELECT * FROM users WHERE id = $1"},
+		{sel().Explain(PGSQL), PGSQL, "EXPLAIN SELECT * FROM users WHERE id = $1"},
+		{sel().Explain(PGSQL, "ANALYZE", "FORMAT JSON"), PGSQL, "EXPLAIN (ANALYZE, FORMAT JSON) SELECT * FROM users WHERE id = $1"},
+		{sel().Explain(MYSQL), MYSQL, "EXPLAIN SELECT * FROM users WHERE id = ?"},
+		{sel().Explain(MYSQL, "FORMAT=JSON"), MYSQL, "EXPLAIN FORMAT=JSON SELECT * FROM users WHERE id = ?"},
+		{sel().Explain(SQLITE), SQLITE, "EXPLAIN QUERY PLAN SELECT * FROM users WHERE id = ?"},
+		{sel().With("a", New("SELECT 1")).Explain(PGSQL), PGSQL, "EXPLAIN WITH a AS (SELECT 1) SELECT * FROM users WHERE id = $1"},
+	}
+
+	for _, tt := range tests {
+		sql, params, err := tt.q.Sql(tt.dialect)
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		if sql != tt.want {
+			t.Errorf("\n got: %q\nwant: %q", sql, tt.want)
+		}
+		if !reflect.DeepEqual(params, []any{7}) {
+			t.Errorf("got unexpected params: %v", params)
+		}
+	}
+
+	for _, q := range []*Query{sel().Explain(MSSQL), sel().Explain(SQLITE, "ANALYZE")} {
+		if _, _, err := q.ToSql(); err == nil {
+			t.Error("expected an error")
+		}
+	}
+}
+
+func TestQuery_ForUpdate(t *testing.T) {
+	q := New("SELECT * FROM jobs WHERE status = ?", "queued").
+		ForUpdate(PGSQL).SkipLocked().Limit(1)
+
+	sql, params, err := q.ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "SELECT * FROM jobs WHERE status = $1 LIMIT 1 FOR UPDATE SKIP LOCKED"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{"queued"}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	sql, _, _ = New("SELECT * FROM jobs").ForShare(MYSQL).NoWait().ToMysql()
+	want = "SELECT * FROM jobs FOR SHARE NOWAIT"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	sql, _, _ = q.CountQuery().ToPgsql()
+	want = "SELECT COUNT(*) FROM (SELECT * FROM jobs WHERE status = $1) count_query"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	_, _, err = New("SELECT * FROM jobs").ForUpdate(SQLITE).ToSql()
+	if err == nil || err.Error() != "FOR UPDATE is not supported by sqlite" {
+		t.Errorf("got unexpected error: %v", err)
+	}
+
+	_, _, err = New("SELECT * FROM jobs").SkipLocked().ToPgsql()
+	if err == nil || err.Error() != "SKIP LOCKED requires ForUpdate or ForShare" {
+		t.Errorf("got unexpected error: %v", err)
+	}
+}
+
+func TestQuery_GroupBy(t *testing.T) {
+	q := New("SELECT team, role, COUNT(*) FROM users WHERE active = ?", true).
+		GroupBy("team", "role").
+		Having("COUNT(*) > ?", 5).
+		Space("ORDER BY team")
+
+	sql, params, err := q.ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "SELECT team, role, COUNT(*) FROM users WHERE active = $1 GROUP BY team, role HAVING COUNT(*) > $2 ORDER BY team"
+	if sql != want {
+		t.Errorf("\n got: %q\nwant: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{true, 5}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	sql, params, _ = New("SELECT team FROM users").GroupBy("team").
+		Having(New("COUNT(*) > ?", 5).Or("MAX(age) < ?", 30)).ToPgsql()
+	want = "SELECT team FROM users GROUP BY team HAVING COUNT(*) > $1 OR MAX(age) < $2"
+	if sql != want {
+		t.Errorf("\n got: %q\nwant: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{5, 30}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	_, _, err = New("SELECT team FROM users").Having(New("COUNT(*) > 5"), 1).ToPgsql()
+	if err == nil {
+		t.Errorf("expected an error for args given with a *Query")
+	}
+}
+
+func TestQuery_OrderBy(t *testing.T) {
+	q := New("SELECT * FROM users WHERE team = ?", "a").
+		OrderBy("last_login", DESC, NullsLast).
+		OrderBy("id", ASC).
+		Limit(10)
+
+	tests := []struct {
+		dialect Dialect
+		want    string
+	}{
+		{PGSQL, "SELECT * FROM users WHERE team = $1 ORDER BY last_login DESC NULLS LAST, id ASC LIMIT 10"},
+		{SQLITE, "SELECT * FROM users WHERE team = ? ORDER BY last_login DESC NULLS LAST, id ASC LIMIT 10"},
+		{MYSQL, "SELECT * FROM users WHERE team = ? ORDER BY last_login IS NULL, last_login DESC, id ASC LIMIT 10"},
+		{MSSQL, "SELECT * FROM users WHERE team = @p1 ORDER BY CASE WHEN last_login IS NULL THEN 1 ELSE 0 END, last_login DESC, id ASC OFFSET 0 ROWS FETCH NEXT 10 ROWS ONLY"},
+	}
+	for _, tc := range tests {
+		sql, params, err := q.Sql(tc.dialect)
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		if sql != tc.want {
+			t.Errorf("%v\n got: %q\nwant: %q", tc.dialect, sql, tc.want)
+		}
+		if !reflect.DeepEqual(params, []any{"a"}) {
+			t.Errorf("got unexpected params: %v", params)
+		}
+	}
+
+	sql, _, _ := New("SELECT * FROM users").OrderBy("name", ASC, NullsFirst).ToMysql()
+	want := "SELECT * FROM users ORDER BY name IS NOT NULL, name ASC"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	sql, _, _ = New("SELECT * FROM users").OrderBy("name", ASC, NullsFirst).ToMssql()
+	want = "SELECT * FROM users ORDER BY CASE WHEN name IS NULL THEN 0 ELSE 1 END, name ASC"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	sql, _, _ = q.CountQuery().ToPgsql()
+	want = "SELECT COUNT(*) FROM (SELECT * FROM users WHERE team = $1) count_query"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	_, _, err := New("SELECT * FROM users").OrderBy("name", "UP").ToPgsql()
+	if err == nil || err.Error() != "invalid order direction: UP" {
+		t.Errorf("got unexpected error: %v", err)
+	}
+
+	_, _, err = New("SELECT * FROM users").OrderBy("name", ASC, "MIDDLE").ToPgsql()
+	if err == nil || err.Error() != "invalid nulls order: [MIDDLE]" {
+		t.Errorf("got unexpected error: %v", err)
+	}
+
+	_, _, err = New("SELECT * FROM users").OrderBy("{{xX_NULLS_", ASC).ToPgsql()
+	if err == nil {
+		t.Errorf("expected an error for a reserved placeholder")
+	}
+}
+
+func TestQuery_From(t *testing.T) {
+	sub := New("SELECT user_id, SUM(total) AS spent FROM orders WHERE year = ?", 2023).GroupBy("user_id")
+	q := New("SELECT s.user_id").From(sub, "s").Space("WHERE s.spent > ?", 100)
+
+	sql, params, err := q.ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "SELECT s.user_id FROM (SELECT user_id, SUM(total) AS spent FROM orders WHERE year = $1 GROUP BY user_id) s WHERE s.spent > $2"
+	if sql != want {
+		t.Errorf("\n got: %q\nwant: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{2023, 100}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	sql, _, _ = New("SELECT *").From("users").ToPgsql()
+	if want = "SELECT * FROM users"; sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	sql, _, _ = New("SELECT u.*").From("users", "u").ToPgsql()
+	if want = "SELECT u.* FROM users u"; sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	sql, _, _ = New("SELECT s.user_id").From(sub, "s").ToOracle()
+	if want = "SELECT s.user_id FROM (SELECT user_id, SUM(total) AS spent FROM orders WHERE year = :1 GROUP BY user_id) s"; sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	_, _, err = New("SELECT *").From(sub).ToPgsql()
+	if err == nil || err.Error() != "FROM subquery requires an alias" {
+		t.Errorf("got unexpected error: %v", err)
+	}
+
+	_, _, err = New("SELECT *").From("users", "u", "v").ToPgsql()
+	if err == nil || err.Error() != "FROM takes one alias, got 2" {
+		t.Errorf("got unexpected error: %v", err)
+	}
+}
+
+func TestQuery_Reset(t *testing.T) {
+	q := Optional("WHERE").And("a = ?", 1).And("b = ?", 2).
+		With("c", New("SELECT 1")).OrderBy("a", ASC).Limit(5).ForUpdate(PGSQL)
+	sql1, params1, _ := q.ToPgsql()
+
+	q.Reset()
+	if !q.Empty() {
+		t.Errorf("got parts after Reset: %v", q.Parts)
+	}
+	sql, params, err := q.ToPgsql()
+	if err != nil || sql != "" || len(params) != 0 {
+		t.Errorf("got: %q %v %v, want an empty query", sql, params, err)
+	}
+
+	q.And("x = ?", 3)
+	sql2, params2, _ := q.ToPgsql()
+
+	want := "WITH c AS (SELECT 1) WHERE a = $1 AND b = $2 ORDER BY a ASC LIMIT 5 FOR UPDATE"
+	if sql1 != want {
+		t.Errorf("got: %q, want: %q", sql1, want)
+	}
+	if !reflect.DeepEqual(params1, []any{1, 2}) {
+		t.Errorf("got unexpected params: %v", params1)
+	}
+	if want = "WHERE x = $1"; sql2 != want {
+		t.Errorf("got: %q, want: %q", sql2, want)
+	}
+	if !reflect.DeepEqual(params2, []any{3}) {
+		t.Errorf("got unexpected params: %v", params2)
+	}
+
+	var nilQ *Query
+	if nilQ.Reset() == nil {
+		t.Errorf("got nil from Reset on a nil Query")
+	}
+}
+
+func TestQuery_Args(t *testing.T) {
+	q := New("SELECT * FROM t WHERE a = ? AND b IN (?)", 1, []string{"x", "y"}).
+		With("c", New("SELECT ?", 0)).
+		And("d = ?", New("(SELECT ?)", true)).
+		OrderBy("a", DESC, NullsLast).
+		Limit(3)
+
+	for _, dialect := range []Dialect{PGSQL, MYSQL, MSSQL, SQLITE, RAW} {
+		_, want, err := q.Sql(dialect)
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		got, err := q.Args(dialect)
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%v got: %v, want: %v", dialect, got, want)
+		}
+	}
+
+	got, _ := q.Args(PGSQL)
+	if want := []any{0, 1, "x", "y", true}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %v, want: %v", got, want)
+	}
+
+	if _, err := New("a = ?").Args(PGSQL); err == nil {
+		t.Errorf("expected an error for a missing arg")
+	}
+
+	cte := New("SELECT * FROM t").With("c", New("SELECT ?"))
+	if _, err := cte.Args(PGSQL); err == nil {
+		t.Errorf("expected an error for a missing arg in a CTE")
+	}
+	if err := cte.Err(); err == nil {
+		t.Errorf("expected Err to include errors in a CTE")
+	}
+
+	var qNil *Query
+	if _, err := qNil.Args(PGSQL); err == nil {
+		t.Errorf("expected an error for a nil query")
+	}
+}
+
+func TestQuery_PrefixSuffix(t *testing.T) {
+	q := New("SELECT * FROM users WHERE team = ?", "a").
+		Prefix("/* request: ? */", "abc").
+		Prefix("/*+ MAX_EXECUTION_TIME(1000) */").
+		Limit(10).
+		Suffix("OPTION (MAXDOP ?)", 2).
+		Suffix("OPTION (RECOMPILE)")
+
+	sql, params, err := q.ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "/* request: $1 */ /*+ MAX_EXECUTION_TIME(1000) */ SELECT * FROM users WHERE team = $2 LIMIT 10 OPTION (MAXDOP $3) OPTION (RECOMPILE)"
+	if sql != want {
+		t.Errorf("\n got: %q\nwant: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{"abc", "a", 2}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	args, _ := q.Args(PGSQL)
+	if !reflect.DeepEqual(args, params) {
+		t.Errorf("got: %v, want: %v", args, params)
+	}
+
+	sql, _, _ = q.Clone().Suffix("-- clone").ToSql()
+	if !strings.HasSuffix(sql, "OPTION (RECOMPILE) -- clone") {
+		t.Errorf("got unexpected sql: %q", sql)
+	}
+
+	sql, _, _ = q.CountQuery().ToPgsql()
+	want = "SELECT COUNT(*) FROM (SELECT * FROM users WHERE team = $1) count_query"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	_, _, err = New("SELECT 1").Suffix("OPTION (MAXDOP ?)").ToSql()
+	if err == nil {
+		t.Errorf("expected an error for a missing suffix arg")
+	}
+}
+
+func TestQuery_Build(t *testing.T) {
+	q := New("SELECT * FROM users WHERE id IN (?)", []int{1, 2}).OrderBy("id", ASC).Limit(5)
+
+	sql1, params1, err := q.Build(PGSQL)
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	if cache, _ := q.cache.Load().(map[Dialect]string); cache[PGSQL] != sql1 {
+		t.Errorf("got cache: %v, want the built sql", cache)
+	}
+	sql2, params2, _ := q.Build(PGSQL)
+	want := "SELECT * FROM users WHERE id IN ($1,$2) ORDER BY id ASC LIMIT 5"
+	if sql1 != want || sql2 != want {
+		t.Errorf("got: %q and %q, want: %q", sql1, sql2, want)
+	}
+	if !reflect.DeepEqual(params1, []any{1, 2}) || !reflect.DeepEqual(params2, params1) {
+		t.Errorf("got unexpected params: %v and %v", params1, params2)
+	}
+
+	sql, _, _ := q.Build(MYSQL)
+	if want := "SELECT * FROM users WHERE id IN (?,?) ORDER BY id ASC LIMIT 5"; sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	q.And("active = ?", true)
+	if cache, _ := q.cache.Load().(map[Dialect]string); len(cache) != 0 {
+		t.Errorf("got cache after a change: %v", cache)
+	}
+	sql, params, _ := q.Build(PGSQL)
+	want = "SELECT * FROM users WHERE id IN ($1,$2) AND active = $3 ORDER BY id ASC LIMIT 5"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{1, 2, true}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	q.Limit(1)
+	if sql, _, _ = q.Build(PGSQL); !strings.HasSuffix(sql, "LIMIT 1") {
+		t.Errorf("got stale sql after Limit: %q", sql)
+	}
+
+	n := 1
+	raw := New("a = ?", &n)
+	raw.Build(RAW)
+	n = 2
+	if sql, _, _ = raw.Build(RAW); sql != "a = 2" {
+		t.Errorf("got: %q, want: %q", sql, "a = 2")
+	}
+
+	if _, _, err = New("a = ?").Build(PGSQL); err == nil {
+		t.Errorf("expected an error for a missing arg")
+	}
+	var qNil *Query
+	if _, _, err = qNil.Build(PGSQL); err == nil {
+		t.Errorf("expected an error for a nil query")
+	}
+}
@@ -1,5 +1,7 @@
 package bqb
 
+import "database/sql/driver"
+
 // Dialect holds the Query dialect
 type Dialect string
 
@@ -8,18 +10,114 @@ const (
 	PGSQL Dialect = "postgres"
 	// MYSQL MySQL dialect
 	MYSQL Dialect = "mysql"
+	// MSSQL Microsoft SQL Server dialect
+	MSSQL Dialect = "sqlserver"
+	// ORACLE Oracle dialect
+	ORACLE Dialect = "oracle"
+	// SQLITE SQLite dialect
+	SQLITE Dialect = "sqlite"
+	// BIGQUERY Google BigQuery dialect, using @p1, @p2 named parameters
+	BIGQUERY Dialect = "bigquery"
+	// CLICKHOUSE ClickHouse dialect, using the positional ? placeholders of
+	// the clickhouse-go driver
+	CLICKHOUSE Dialect = "clickhouse"
+	// COCKROACH CockroachDB dialect. It uses the same $1, $2 placeholders as
+	// postgres, and helpers that support postgres syntax accept it too.
+	COCKROACH Dialect = "cockroach"
+	// DUCKDB DuckDB dialect, using $1, $2 placeholders like postgres
+	DUCKDB Dialect = "duckdb"
+	// SNOWFLAKE Snowflake dialect, using the positional ? placeholders of
+	// the gosnowflake driver
+	SNOWFLAKE Dialect = "snowflake"
+	// TRINO Trino and Presto dialect, using positional ? placeholders
+	TRINO Dialect = "trino"
 	// RAW dialect uses no parameter conversion
 	RAW Dialect = "raw"
-	// SQL generic dialect
+	// SQL generic dialect, which uses ? placeholders as most databases and
+	// drivers do. It's the dialect used by ToSql.
 	SQL Dialect = "sql"
 
-	paramPh = "{{xX_PARAM_Xx}}"
+	// ParamPlaceholder marks the position of each bound parameter in the sql
+	// passed to a DialectFunc.
+	ParamPlaceholder = paramPh
+
+	paramPh  = "{{xX_PARAM_Xx}}"
+	escapePh = "XXX___XXX"
+	limitPh  = "{{xX_LIMIT_%d_%d_Xx}}"
+	nullsPh  = "{{xX_NULLS_%v_Xx}}%v{{xX_NULLS_Xx}}"
+	identPh  = "{{xX_IDENT_%v_Xx}}"
+	numPh    = "{{xX_NUM_Xx}}"
+	concatPh = "{{xX_CONCAT_%v_Xx}}"
+)
+
+// Direction is the sort direction of an OrderBy column.
+type Direction string
+
+const (
+	// ASC sorts in ascending order
+	ASC Direction = "ASC"
+	// DESC sorts in descending order
+	DESC Direction = "DESC"
+)
+
+// IntervalUnit is the unit of an Interval, DateAdd or DateSub.
+type IntervalUnit string
+
+const (
+	// SECOND interval of seconds
+	SECOND IntervalUnit = "SECOND"
+	// MINUTE interval of minutes
+	MINUTE IntervalUnit = "MINUTE"
+	// HOUR interval of hours
+	HOUR IntervalUnit = "HOUR"
+	// DAY interval of days
+	DAY IntervalUnit = "DAY"
+	// WEEK interval of weeks
+	WEEK IntervalUnit = "WEEK"
+	// MONTH interval of months
+	MONTH IntervalUnit = "MONTH"
+	// YEAR interval of years
+	YEAR IntervalUnit = "YEAR"
 )
 
+// NullsOrder places NULL values before or after the others in OrderBy.
+type NullsOrder string
+
+const (
+	// NullsFirst sorts NULL values before all others
+	NullsFirst NullsOrder = "FIRST"
+	// NullsLast sorts NULL values after all others
+	NullsLast NullsOrder = "LAST"
+)
+
+// RawTimeFormat is the layout used for time.Time values in Raw queries.
+var RawTimeFormat = "2006-01-02 15:04:05"
+
+// DialectFunc converts the ParamPlaceholder values in sql to the
+// placeholder syntax of a custom dialect. See RegisterDialect.
+type DialectFunc func(sql string, params []any) (string, error)
+
+// Assignment is a `column = value` pair, as used in the SET list of an
+// upsert. See Set.
+type Assignment struct {
+	Column string
+	Value  any
+}
+
 // Embedded is a string type that is directly embedded into the query.
 // Note: Like Embedder, this is not to be used for untrusted input.
 type Embedded string
 
+// Identifier is a string type for table and column names chosen at run time,
+// such as a user selected sort column. It's embedded into the query quoted
+// for the dialect the query is built with, e.g. "name" or `name` for MySQL.
+// Only letters, digits and underscores are allowed, with `.` separating the
+// parts of a qualified name, so that it's safe to use with untrusted input.
+// Since the quoting depends on the database, building a query that contains
+// an Identifier with the generic SQL dialect (ToSql) or RAW is an error; use
+// the database's dialect, e.g. ToMysql.
+type Identifier string
+
 // Embedder embeds a value directly into a query string.
 // Note: Since this is embedded and not bound,
 // attention must be paid to sanitizing this input.
@@ -31,6 +129,16 @@ type Embedder interface {
 // a JSON object without requiring reflection.
 type JsonMap map[string]interface{}
 
+// Value implements driver.Valuer, returning the map as a JSON string.
+func (m JsonMap) Value() (driver.Value, error) {
+	return jsonValue(m)
+}
+
 // JsonList is a type that tells bqb to convert the parameter to a JSON
 // list without requiring reflection.
 type JsonList []interface{}
+
+// Value implements driver.Valuer, returning the list as a JSON string.
+func (l JsonList) Value() (driver.Value, error) {
+	return jsonValue(l)
+}
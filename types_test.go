@@ -1,6 +1,7 @@
 package bqb
 
 import (
+	"database/sql/driver"
 	"reflect"
 	"strings"
 	"testing"
@@ -98,3 +99,39 @@ func TestEmbedded(t *testing.T) {
 	}
 
 }
+
+func TestJsonValuer(t *testing.T) {
+	m := JsonMap{"a": JsonMap{"b": []int{1, 2}}, "c": JsonList{"d", true, nil}}
+	l := JsonList{1, JsonMap{"e": "f"}, JsonList{2.5}}
+
+	for _, v := range []driver.Valuer{m, l} {
+		got, err := v.Value()
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+
+		_, params, err := New("?", v).ToSql()
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		if got != params[0] {
+			t.Errorf("Value() %v does not match bound param %v", got, params[0])
+		}
+	}
+
+	got, _ := m.Value()
+	want := `{"a":{"b":[1,2]},"c":["d",true,null]}`
+	if got != want {
+		t.Errorf("\n got:%v\nwant:%v", got, want)
+	}
+
+	got, _ = l.Value()
+	want = `[1,{"e":"f"},[2.5]]`
+	if got != want {
+		t.Errorf("\n got:%v\nwant:%v", got, want)
+	}
+
+	if _, err := (JsonList{func() {}}).Value(); err == nil {
+		t.Errorf("expected error for invalid JsonList")
+	}
+}
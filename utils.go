@@ -1,47 +1,346 @@
 package bqb
 
 import (
+	"database/sql"
 	"database/sql/driver"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+var (
+	dialectsMu sync.RWMutex
+	dialects   = map[Dialect]DialectFunc{}
+)
+
+// RegisterDialect adds a custom placeholder conversion for `name`, which is
+// then used by Query.Sql(name). Registered dialects take precedence over the
+// built-in ones. Passing a nil fn removes the registration.
+func RegisterDialect(name Dialect, fn DialectFunc) {
+	dialectsMu.Lock()
+	defer dialectsMu.Unlock()
+	if fn == nil {
+		delete(dialects, name)
+		return
+	}
+	dialects[name] = fn
+}
+
+// driverDialects maps well known database/sql driver names to their dialect.
+var driverDialects = map[string]Dialect{
+	"bigquery":   BIGQUERY,
+	"clickhouse": CLICKHOUSE,
+	"duckdb":     DUCKDB,
+	"godror":     ORACLE,
+	"mssql":      MSSQL,
+	"mysql":      MYSQL,
+	"oracle":     ORACLE,
+	"pgx":        PGSQL,
+	"pgx/v5":     PGSQL,
+	"postgres":   PGSQL,
+	"snowflake":  SNOWFLAKE,
+	"sqlite":     SQLITE,
+	"sqlite3":    SQLITE,
+	"sqlserver":  MSSQL,
+	"trino":      TRINO,
+}
+
+// DialectForDB returns the Dialect for the driver `db` was opened with, by
+// matching it against the registered database/sql driver names.
+func DialectForDB(db *sql.DB) (Dialect, error) {
+	if db == nil {
+		return "", errors.New("cannot get dialect of nil DB")
+	}
+	want := reflect.TypeOf(db.Driver())
+	for _, name := range sql.Drivers() {
+		dialect, ok := driverDialects[name]
+		if !ok {
+			continue
+		}
+		// sql.Open doesn't connect, it only resolves the registered driver
+		other, err := sql.Open(name, "")
+		if err != nil {
+			continue
+		}
+		match := reflect.TypeOf(other.Driver()) == want
+		_ = other.Close()
+		if match {
+			return dialect, nil
+		}
+	}
+	return "", fmt.Errorf("no dialect found for driver: %T", db.Driver())
+}
+
+// Rebind converts a query using ? placeholders, such as the output of
+// ToSql, to the placeholders of dialect. Like sqlx.Rebind, each ? becomes
+// the dialect's numbered placeholder, e.g. $1 for PGSQL, but ?? is treated
+// as an escaped ? as it is by the rest of bqb. RAW queries, and queries for a
+// dialect with no built-in or registered replacement, are returned as is.
+func Rebind(dialect Dialect, sql string) string {
+	if dialect == RAW {
+		return sql
+	}
+	text := strings.ReplaceAll(sql, "??", escapePh)
+	params := make([]any, strings.Count(text, "?"))
+	text = strings.ReplaceAll(text, "?", paramPh)
+	text = strings.ReplaceAll(text, escapePh, "??")
+
+	rebound, err := dialectReplace(dialect, text, params)
+	if err != nil || strings.Contains(rebound, paramPh) {
+		return sql
+	}
+	return rebound
+}
+
 func dialectReplace(dialect Dialect, sql string, params []any) (string, error) {
 	const (
-		questionMark                = "?"
-		doubleQuestionMarkDelimiter = "??"
-		parameterPlaceholder        = paramPh
+		questionMark         = "?"
+		parameterPlaceholder = paramPh
 	)
 
+	if strings.Contains(sql, "{{xX_LIMIT_") {
+		sql = limitReplace(dialect, sql)
+	}
+	if strings.Contains(sql, "{{xX_NULLS_") {
+		sql = nullsReplace(dialect, sql)
+	}
+	if strings.Contains(sql, "{{xX_CONCAT_") {
+		sql = concatReplace(dialect, sql)
+	}
+	if strings.Contains(sql, "{{xX_IDENT_") {
+		if dialect == SQL || dialect == RAW {
+			// Quoting differs by database, and a wrongly quoted name is a
+			// string literal in some of them, e.g. "name" in MySQL
+			return "", fmt.Errorf("cannot quote an Identifier for %v, build the query with its database's dialect", dialect)
+		}
+		sql = identReplace(dialect, sql)
+	}
+
+	var numeric map[int]bool
+	if strings.Contains(sql, numPh) {
+		if dialect == RAW {
+			numeric = numericParams(sql)
+		}
+		sql = strings.ReplaceAll(sql, numPh, "")
+	}
+
+	dialectsMu.RLock()
+	fn, ok := dialects[dialect]
+	dialectsMu.RUnlock()
+	if ok {
+		return fn(sql, params)
+	}
+
 	switch dialect {
 	case RAW:
-		for _, param := range params {
-			p, err := paramToRaw(param)
-			if err != nil {
-				return "", err
+		return replacePlaceholders(sql, false, func(builder *strings.Builder, i int) error {
+			if i >= len(params) {
+				return fmt.Errorf("missing parameter %d for raw query", i+1)
 			}
-			sql = strings.Replace(sql, paramPh, p, 1)
-		}
-		return sql, nil
-	case MYSQL, SQL:
+			if s, ok := params[i].(string); ok && numeric[i] {
+				builder.WriteString(s)
+				return nil
+			}
+			p, err := paramToRaw(params[i])
+			builder.WriteString(p)
+			return err
+		})
+	case MYSQL, SQL, SQLITE:
 		return strings.ReplaceAll(sql, paramPh, questionMark), nil
-	case PGSQL:
-		sql = strings.ReplaceAll(sql, doubleQuestionMarkDelimiter, questionMark)
-		parts := strings.Split(sql, paramPh)
-		var builder strings.Builder
-		for i := range params {
-			_, _ = builder.WriteString(parts[i] + "$" + strconv.Itoa(i+1))
-		}
-		builder.WriteString(parts[len(parts)-1])
-		return builder.String(), nil
+	case CLICKHOUSE, SNOWFLAKE, TRINO:
+		return replacePlaceholders(sql, true, func(builder *strings.Builder, _ int) error {
+			builder.WriteString(questionMark)
+			return nil
+		})
+	case PGSQL, COCKROACH, DUCKDB:
+		return replacePlaceholders(sql, true, numbered("$"))
+	case MSSQL, BIGQUERY:
+		return replacePlaceholders(sql, true, numbered("@p"))
+	case ORACLE:
+		return replacePlaceholders(sql, true, numbered(":"))
 	default:
 		// No replacement defined for dialect
 		return sql, nil
 	}
 }
 
+// concatReplace replaces the concatPh placeholders in sql with the string
+// concatenation syntax of dialect. MySQL treats || as a logical OR, so it
+// and SQL Server use CONCAT(a,b) rather than a || b.
+func concatReplace(dialect Dialect, sql string) string {
+	start, sep, end := "", " || ", ""
+	if dialect == MYSQL || dialect == MSSQL {
+		start, sep, end = "CONCAT(", ",", ")"
+	}
+	return strings.NewReplacer(
+		fmt.Sprintf(concatPh, "START"), start,
+		fmt.Sprintf(concatPh, "SEP"), sep,
+		fmt.Sprintf(concatPh, "END"), end,
+	).Replace(sql)
+}
+
+var (
+	identRegexp   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+	identPhRegexp = regexp.MustCompile(`\{\{xX_IDENT_([A-Za-z0-9_.]+)_Xx\}\}`)
+)
+
+// identReplace replaces the identPh placeholders in sql with the Identifier
+// they hold, quoted for dialect.
+func identReplace(dialect Dialect, sql string) string {
+	return identPhRegexp.ReplaceAllStringFunc(sql, func(ph string) string {
+		name := identPhRegexp.FindStringSubmatch(ph)[1]
+		return Ident(dialect, strings.Split(name, ".")...)
+	})
+}
+
+// numericParams returns the indexes of the parameters in sql marked with
+// numPh, which are numbers bound as strings such as a *big.Int.
+func numericParams(sql string) map[int]bool {
+	numeric := map[int]bool{}
+	parts := strings.Split(sql, paramPh)
+	for i := 0; i < len(parts)-1; i++ {
+		if strings.HasSuffix(parts[i], numPh) {
+			numeric[i] = true
+		}
+	}
+	return numeric
+}
+
+var limitPhRegexp = regexp.MustCompile(`\{\{xX_LIMIT_(-?\d+)_(-?\d+)_Xx\}\}`)
+
+// limitReplace replaces the limitPh placeholders in sql with the LIMIT and
+// OFFSET syntax of dialect.
+func limitReplace(dialect Dialect, sql string) string {
+	return limitPhRegexp.ReplaceAllStringFunc(sql, func(ph string) string {
+		match := limitPhRegexp.FindStringSubmatch(ph)
+		limit, offset := match[1], match[2]
+
+		switch dialect {
+		case MSSQL, ORACLE:
+			if offset == "-1" {
+				offset = "0"
+			}
+			clause := "OFFSET " + offset + " ROWS"
+			if limit != "-1" {
+				clause += " FETCH NEXT " + limit + " ROWS ONLY"
+			}
+			return clause
+		}
+
+		if limit == "-1" {
+			switch dialect {
+			case MYSQL:
+				// MySQL has no OFFSET without LIMIT, so use the max row count
+				limit = "18446744073709551615"
+			case SQLITE:
+				limit = "-1"
+			default:
+				return "OFFSET " + offset
+			}
+		}
+		clause := "LIMIT " + limit
+		if offset != "-1" {
+			clause += " OFFSET " + offset
+		}
+		return clause
+	})
+}
+
+var nullsPhRegexp = regexp.MustCompile(`\{\{xX_NULLS_(FIRST|LAST)_Xx\}\}(.*?)\{\{xX_NULLS_Xx\}\} (ASC|DESC)`)
+
+// nullsReplace replaces the nullsPh placeholders in sql with the NULLS
+// FIRST/LAST syntax of dialect. MySQL and SQL Server have no such syntax, so
+// the column is first sorted by whether it's NULL instead.
+func nullsReplace(dialect Dialect, sql string) string {
+	return nullsPhRegexp.ReplaceAllStringFunc(sql, func(ph string) string {
+		match := nullsPhRegexp.FindStringSubmatch(ph)
+		nulls, col, dir := match[1], match[2], match[3]
+
+		switch dialect {
+		case MYSQL:
+			if nulls == "LAST" {
+				return col + " IS NULL, " + col + " " + dir
+			}
+			return col + " IS NOT NULL, " + col + " " + dir
+		case MSSQL:
+			if nulls == "LAST" {
+				return "CASE WHEN " + col + " IS NULL THEN 1 ELSE 0 END, " + col + " " + dir
+			}
+			return "CASE WHEN " + col + " IS NULL THEN 0 ELSE 1 END, " + col + " " + dir
+		default:
+			return col + " " + dir + " NULLS " + nulls
+		}
+	})
+}
+
+// numbered returns a placeholder renderer for replacePlaceholders that
+// writes `prefix` followed by the 1-based parameter index, e.g. $1.
+func numbered(prefix string) func(*strings.Builder, int) error {
+	var buf [20]byte
+	return func(builder *strings.Builder, i int) error {
+		builder.WriteString(prefix)
+		builder.Write(strconv.AppendInt(buf[:0], int64(i+1), 10))
+		return nil
+	}
+}
+
+// replacePlaceholders replaces each paramPh in sql with the output of
+// render for its 0-based index in a single left to right pass. When
+// collapse is true each escaped ?? is also replaced with ?.
+func replacePlaceholders(sql string, collapse bool, render func(*strings.Builder, int) error) (string, error) {
+	// Numbered placeholders are shorter than paramPh, so the output will
+	// usually fit in the length of the input.
+	var builder strings.Builder
+	builder.Grow(len(sql))
+
+	nextEsc := -1
+	if collapse {
+		nextEsc = strings.Index(sql, "??")
+	}
+	nextPh := strings.Index(sql, paramPh)
+
+	pos, n := 0, 0
+	for nextPh >= 0 || nextEsc >= 0 {
+		if nextEsc >= 0 && (nextPh < 0 || nextEsc < nextPh) {
+			builder.WriteString(sql[pos:nextEsc])
+			builder.WriteByte('?')
+			pos = nextEsc + 2
+			nextEsc = indexFrom(sql, "??", pos)
+			continue
+		}
+
+		builder.WriteString(sql[pos:nextPh])
+		if err := render(&builder, n); err != nil {
+			return "", err
+		}
+		n++
+		pos = nextPh + len(paramPh)
+		nextPh = indexFrom(sql, paramPh, pos)
+	}
+	builder.WriteString(sql[pos:])
+
+	return builder.String(), nil
+}
+
+// indexFrom returns the index of substr in s at or after start, or -1.
+func indexFrom(s, substr string, start int) int {
+	i := strings.Index(s[start:], substr)
+	if i < 0 {
+		return -1
+	}
+	return start + i
+}
+
 func convertArg(text string, arg any) (string, []any, []error) {
 	var newArgs []any
 	var errs []error
@@ -49,10 +348,34 @@ func convertArg(text string, arg any) (string, []any, []error) {
 	switch v := arg.(type) {
 
 	case Embedder:
-		text = strings.Replace(text, "?", v.RawValue(), 1)
+		raw := v.RawValue()
+		if err := checkReserved(raw); err != nil {
+			errs = append(errs, err)
+		}
+		text = strings.Replace(text, "?", raw, 1)
+
+	case *JsonMap, *JsonList:
+		// Handled before driver.Valuer so that nil pointers become 'null'
+		text = strings.Replace(text, "?", paramPh, 1)
+		val, err := jsonValue(v)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			newArgs = append(newArgs, val)
+		}
+
+	case json.RawMessage:
+		// Already encoded, so bound as a string rather than marshaled again
+		text = strings.Replace(text, "?", paramPh, 1)
+		newArgs = append(newArgs, rawJsonValue(v))
 
 	case driver.Valuer:
 		text = strings.Replace(text, "?", paramPh, 1)
+		if nilValuerPointer(v) {
+			// Value has a value receiver, which panics on a nil pointer
+			newArgs = append(newArgs, nil)
+			break
+		}
 		val, err := v.Value()
 		if err != nil {
 			errs = append(errs, err)
@@ -65,7 +388,25 @@ func convertArg(text string, arg any) (string, []any, []error) {
 			newPh = append(newPh, paramPh)
 			newArgs = append(newArgs, i)
 		}
-		text = strings.Replace(text, "?", strings.Join(newPh, ","), 1)
+		if len(newPh) > 0 {
+			text = strings.Replace(text, "?", strings.Join(newPh, ","), 1)
+		} else {
+			text = strings.Replace(text, "?", paramPh, 1)
+			newArgs = append(newArgs, nil)
+		}
+
+	case []int64:
+		newPh := []string{}
+		for _, i := range v {
+			newPh = append(newPh, paramPh)
+			newArgs = append(newArgs, i)
+		}
+		if len(newPh) > 0 {
+			text = strings.Replace(text, "?", strings.Join(newPh, ","), 1)
+		} else {
+			text = strings.Replace(text, "?", paramPh, 1)
+			newArgs = append(newArgs, nil)
+		}
 
 	case []*int:
 		newPh := []string{}
@@ -80,13 +421,57 @@ func convertArg(text string, arg any) (string, []any, []error) {
 			newArgs = append(newArgs, nil)
 		}
 
+	case []bool:
+		newPh := []string{}
+		for _, b := range v {
+			newPh = append(newPh, paramPh)
+			newArgs = append(newArgs, b)
+		}
+		if len(newPh) > 0 {
+			text = strings.Replace(text, "?", strings.Join(newPh, ","), 1)
+		} else {
+			text = strings.Replace(text, "?", paramPh, 1)
+			newArgs = append(newArgs, nil)
+		}
+
+	case []float32:
+		newPh := []string{}
+		for _, f := range v {
+			newPh = append(newPh, paramPh)
+			newArgs = append(newArgs, f)
+		}
+		if len(newPh) > 0 {
+			text = strings.Replace(text, "?", strings.Join(newPh, ","), 1)
+		} else {
+			text = strings.Replace(text, "?", paramPh, 1)
+			newArgs = append(newArgs, nil)
+		}
+
+	case []float64:
+		newPh := []string{}
+		for _, f := range v {
+			newPh = append(newPh, paramPh)
+			newArgs = append(newArgs, f)
+		}
+		if len(newPh) > 0 {
+			text = strings.Replace(text, "?", strings.Join(newPh, ","), 1)
+		} else {
+			text = strings.Replace(text, "?", paramPh, 1)
+			newArgs = append(newArgs, nil)
+		}
+
 	case []string:
 		newPh := []string{}
 		for _, s := range v {
 			newPh = append(newPh, paramPh)
 			newArgs = append(newArgs, s)
 		}
-		text = strings.Replace(text, "?", strings.Join(newPh, ","), 1)
+		if len(newPh) > 0 {
+			text = strings.Replace(text, "?", strings.Join(newPh, ","), 1)
+		} else {
+			text = strings.Replace(text, "?", paramPh, 1)
+			newArgs = append(newArgs, nil)
+		}
 
 	case []*string:
 		newPh := []string{}
@@ -101,13 +486,31 @@ func convertArg(text string, arg any) (string, []any, []error) {
 			newArgs = append(newArgs, nil)
 		}
 
+	case []time.Time:
+		newPh := []string{}
+		for _, tm := range v {
+			newPh = append(newPh, paramPh)
+			newArgs = append(newArgs, tm)
+		}
+		if len(newPh) > 0 {
+			text = strings.Replace(text, "?", strings.Join(newPh, ","), 1)
+		} else {
+			text = strings.Replace(text, "?", paramPh, 1)
+			newArgs = append(newArgs, nil)
+		}
+
 	case []any:
 		newPh := []string{}
 		for _, s := range v {
 			newPh = append(newPh, paramPh)
 			newArgs = append(newArgs, s)
 		}
-		text = strings.Replace(text, "?", strings.Join(newPh, ","), 1)
+		if len(newPh) > 0 {
+			text = strings.Replace(text, "?", strings.Join(newPh, ","), 1)
+		} else {
+			text = strings.Replace(text, "?", paramPh, 1)
+			newArgs = append(newArgs, nil)
+		}
 
 	case *Query:
 		if v == nil {
@@ -123,28 +526,105 @@ func convertArg(text string, arg any) (string, []any, []error) {
 			newArgs = append(newArgs, params...)
 		}
 
-	case JsonMap, JsonList:
+	case Query:
+		return convertArg(text, &v)
+
+	case Identifier:
+		if !identRegexp.MatchString(string(v)) {
+			errs = append(errs, fmt.Errorf("invalid identifier: %q", v))
+		}
+		text = strings.Replace(text, "?", fmt.Sprintf(identPh, v), 1)
+
+	case Embedded:
+		if err := checkReserved(string(v)); err != nil {
+			errs = append(errs, err)
+		}
+		text = strings.Replace(text, "?", string(v), 1)
+
+	case time.Time, *time.Time:
+		// Times are Stringers, but drivers handle them natively
 		text = strings.Replace(text, "?", paramPh, 1)
-		bytes, err := json.Marshal(v)
-		if err != nil {
-			errs = append(errs, fmt.Errorf("cann jsonify struct: %v", err))
+		newArgs = append(newArgs, v)
+
+	case *big.Int, *big.Float:
+		// Bound as a string, and marked so that Raw queries render it as an
+		// unquoted number
+		if isNilPointer(v) {
+			text = strings.Replace(text, "?", paramPh, 1)
+			newArgs = append(newArgs, nil)
+		} else if f, ok := v.(*big.Float); ok && f.IsInf() {
+			text = strings.Replace(text, "?", paramPh, 1)
+			errs = append(errs, fmt.Errorf("cannot bind %v", f))
 		} else {
-			newArgs = append(newArgs, string(bytes))
+			text = strings.Replace(text, "?", numPh+paramPh, 1)
+			newArgs = append(newArgs, bigToString(v))
 		}
 
-	case *JsonMap, *JsonList:
+	case net.IP, net.IPNet, *net.IPNet:
+		// Bound as strings for inet and cidr columns, rather than as bytes
 		text = strings.Replace(text, "?", paramPh, 1)
-		bytes, err := json.Marshal(v)
-		if err != nil {
-			errs = append(errs, fmt.Errorf("cann jsonify struct: %v", err))
+		newArgs = append(newArgs, ipValue(v))
+
+	case fmt.Stringer:
+		text = strings.Replace(text, "?", paramPh, 1)
+		if isNilPointer(v) {
+			newArgs = append(newArgs, nil)
 		} else {
-			newArgs = append(newArgs, string(bytes))
+			newArgs = append(newArgs, v.String())
 		}
 
-	case Embedded:
-		text = strings.Replace(text, "?", string(v), 1)
-
 	default:
+		rv := reflect.ValueOf(v)
+
+		// Pointers to slices are expanded like the slice, with nil as NULL
+		if rv.Kind() == reflect.Pointer && rv.Type().Elem().Kind() == reflect.Slice &&
+			rv.Type().Elem().Elem().Kind() != reflect.Uint8 {
+			if rv.IsNil() {
+				text = strings.Replace(text, "?", paramPh, 1)
+				newArgs = append(newArgs, nil)
+				break
+			}
+			return convertArg(text, rv.Elem().Interface())
+		}
+
+		// Byte arrays such as [16]byte are bound as a single []byte value
+		if rv.Kind() == reflect.Array && rv.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(b), rv)
+			text = strings.Replace(text, "?", paramPh, 1)
+			newArgs = append(newArgs, b)
+			break
+		}
+
+		// Slices and arrays without an explicit case are expanded element by
+		// element, except byte slices which are bound as a single value.
+		// Elements that are a driver.Valuer are bound as their value.
+		if (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array) && rv.Type().Elem().Kind() != reflect.Uint8 {
+			newPh := []string{}
+			for i := 0; i < rv.Len(); i++ {
+				newPh = append(newPh, paramPh)
+				elem := rv.Index(i).Interface()
+				if raw, ok := elem.(json.RawMessage); ok {
+					elem = rawJsonValue(raw)
+				} else if valuer, ok := elem.(driver.Valuer); ok {
+					if nilValuerPointer(elem) {
+						elem = nil
+					} else if val, err := valuer.Value(); err != nil {
+						errs = append(errs, err)
+					} else {
+						elem = val
+					}
+				}
+				newArgs = append(newArgs, elem)
+			}
+			if len(newPh) > 0 {
+				text = strings.Replace(text, "?", strings.Join(newPh, ","), 1)
+			} else {
+				text = strings.Replace(text, "?", paramPh, 1)
+				newArgs = append(newArgs, nil)
+			}
+			break
+		}
 		text = strings.Replace(text, "?", paramPh, 1)
 		newArgs = append(newArgs, v)
 	}
@@ -152,26 +632,81 @@ func convertArg(text string, arg any) (string, []any, []error) {
 	return text, newArgs, errs
 }
 
-func checkParamCounts(text, original string, args []any) error {
+// checkReserved returns an error if text contains one of the placeholders
+// used internally, since it would be replaced when the query is built.
+func checkReserved(text string) error {
+	for _, ph := range []string{paramPh, escapePh, "{{xX_LIMIT_", "{{xX_NULLS_", "{{xX_IDENT_", "{{xX_CONCAT_", numPh} {
+		if strings.Contains(text, ph) {
+			return fmt.Errorf("reserved placeholder %v in text: %v", ph, text)
+		}
+	}
+	return nil
+}
+
+// checkParamCounts returns an error if the ? placeholders of text don't
+// match its args. used is the number of args passed for original, so the
+// first extra ? is the one after them.
+func checkParamCounts(text, original string, args []any, used int) error {
 	extraCount := strings.Count(text, "?")
 	if extraCount > 0 {
+		if offset := placeholderOffset(original, used); offset >= 0 {
+			return fmt.Errorf("extra ? in text: %v (%d args) at offset %d near %q",
+				original, len(args), offset, snippet(original, offset))
+		}
 		return fmt.Errorf("extra ? in text: %v (%d args)", original, len(args))
 	}
 
 	paramCount := strings.Count(text, paramPh)
 	if paramCount < len(args) {
-		return fmt.Errorf("missing ? in text: %v (%d args)", original, len(args))
+		return fmt.Errorf("missing ? in text: %v (%d args), %d more args than placeholders",
+			original, len(args), len(args)-paramCount)
 	}
 	return nil
 }
 
+// placeholderOffset returns the rune offset in text of the ? placeholder
+// following the first n, skipping escaped ??, or -1 if there isn't one.
+func placeholderOffset(text string, n int) int {
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '?' {
+			continue
+		}
+		if i+1 < len(runes) && runes[i+1] == '?' {
+			i++
+			continue
+		}
+		if n == 0 {
+			return i
+		}
+		n--
+	}
+	return -1
+}
+
+// snippet returns the text surrounding the rune offset, for error messages.
+func snippet(text string, offset int) string {
+	const width = 15
+	runes := []rune(text)
+	start, end := offset-width, offset+width+1
+	if start < 0 {
+		start = 0
+	}
+	if end > len(runes) {
+		end = len(runes)
+	}
+	return string(runes[start:end])
+}
+
 func makePart(text string, args ...any) QueryPart {
-	tempPh := "XXX___XXX"
 	originalText := text
-	text = strings.ReplaceAll(text, "??", tempPh)
+	text = strings.ReplaceAll(text, "??", escapePh)
 
 	var newArgs []any
 	errs := make([]error, 0)
+	if err := checkReserved(originalText); err != nil {
+		errs = append(errs, err)
+	}
 
 	for _, arg := range args {
 		argText, fArgs, argErrs := convertArg(text, arg)
@@ -179,14 +714,14 @@ func makePart(text string, args ...any) QueryPart {
 			errs = append(errs, argErrs...)
 		}
 		newArgs = append(newArgs, fArgs...)
-		text = strings.ReplaceAll(argText, "??", tempPh)
+		text = strings.ReplaceAll(argText, "??", escapePh)
 	}
 
-	if err := checkParamCounts(text, originalText, newArgs); err != nil {
+	if err := checkParamCounts(text, originalText, newArgs, len(args)); err != nil {
 		errs = append(errs, err)
 	}
 
-	text = strings.ReplaceAll(text, tempPh, "??")
+	text = strings.ReplaceAll(text, escapePh, "??")
 
 	return QueryPart{
 		Text:   text,
@@ -195,28 +730,198 @@ func makePart(text string, args ...any) QueryPart {
 	}
 }
 
+// namedToPositional replaces each `:name` in text with ? and returns the
+// matching values from args in order. Postgres style `::` casts and text in
+// single quotes are left alone.
+func namedToPositional(text string, args map[string]any) (string, []any, error) {
+	var builder strings.Builder
+	var params []any
+	used := map[string]bool{}
+	inQuote := false
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c == '\'' {
+			inQuote = !inQuote
+		}
+		if c != ':' || inQuote || (i > 0 && text[i-1] == ':') ||
+			i+1 >= len(text) || !isNameStart(text[i+1]) {
+			builder.WriteByte(c)
+			continue
+		}
+
+		end := i + 1
+		for end < len(text) && isNameChar(text[end]) {
+			end++
+		}
+		name := text[i+1 : end]
+		val, ok := args[name]
+		if !ok {
+			return "", nil, fmt.Errorf("missing named parameter %q in text: %v", name, text)
+		}
+		used[name] = true
+		params = append(params, val)
+		builder.WriteByte('?')
+		i = end - 1
+	}
+
+	for name := range args {
+		if !used[name] {
+			return "", nil, fmt.Errorf("unused named parameter %q in text: %v", name, text)
+		}
+	}
+
+	return builder.String(), params, nil
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
+
 func paramToRaw(param any) (string, error) {
 	switch p := param.(type) {
 	case bool:
 		return fmt.Sprintf("%v", p), nil
-	case float32, float64, int, int8, int16, int32, int64,
-		uint8, uint16, uint32, uint64:
+	case float32:
+		return floatToRaw(float64(p), 32)
+	case float64:
+		return floatToRaw(p, 64)
+	case int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64:
 		return fmt.Sprintf("%v", p), nil
 	case *int:
 		if p == nil {
 			return "NULL", nil
 		}
 		return fmt.Sprintf("%v", *p), nil
+	case *bool, *float32, *float64, *int8, *int16, *int32, *int64,
+		*uint, *uint8, *uint16, *uint32, *uint64:
+		rv := reflect.ValueOf(p)
+		if rv.IsNil() {
+			return "NULL", nil
+		}
+		return paramToRaw(rv.Elem().Interface())
 	case string:
-		return fmt.Sprintf("'%v'", p), nil
+		return quoteString(p), nil
 	case *string:
 		if p == nil {
 			return "NULL", nil
 		}
-		return fmt.Sprintf("'%v'", *p), nil
+		return quoteString(*p), nil
+	case []byte:
+		if p == nil {
+			return "NULL", nil
+		}
+		return `'\x` + hex.EncodeToString(p) + "'", nil
+	case json.RawMessage:
+		if p == nil {
+			return "NULL", nil
+		}
+		return quoteString(string(p)), nil
+	case time.Time:
+		return quoteString(p.Format(RawTimeFormat)), nil
+	case *time.Time:
+		if p == nil {
+			return "NULL", nil
+		}
+		return quoteString(p.Format(RawTimeFormat)), nil
+	case net.IP, net.IPNet, *net.IPNet:
+		if ip := ipValue(p); ip != nil {
+			return quoteString(ip.(string)), nil
+		}
+		return "NULL", nil
+	case fmt.Stringer:
+		if isNilPointer(p) {
+			return "NULL", nil
+		}
+		return quoteString(p.String()), nil
 	case nil:
 		return "NULL", nil
 	default:
 		return "", fmt.Errorf("unsupported type for Raw query: %T", p)
 	}
 }
+
+// bigToString formats a *big.Int or *big.Float as a decimal number. Floats
+// use the fewest digits that represent them exactly, rather than the 10
+// significant digits of big.Float.String.
+func bigToString(v any) string {
+	if f, ok := v.(*big.Float); ok {
+		return f.Text('f', -1)
+	}
+	return v.(*big.Int).String()
+}
+
+// floatToRaw formats f as a decimal literal, since sql engines don't all
+// accept exponents such as 1e+06. NaN and infinities have no literal.
+func floatToRaw(f float64, bitSize int) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("cannot use %v in a Raw query", f)
+	}
+	return strconv.FormatFloat(f, 'f', -1, bitSize), nil
+}
+
+// rawJsonValue returns the JSON text of raw as a string, or nil for a nil
+// RawMessage.
+func rawJsonValue(raw json.RawMessage) any {
+	if raw == nil {
+		return nil
+	}
+	return string(raw)
+}
+
+// jsonValue returns v encoded as a JSON string.
+func jsonValue(v any) (driver.Value, error) {
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("cannot jsonify struct: %v", err)
+	}
+	return string(bytes), nil
+}
+
+// ipValue returns the canonical string form of a net.IP, net.IPNet or
+// *net.IPNet, or nil for a nil IP or network.
+func ipValue(v any) any {
+	switch ip := v.(type) {
+	case net.IP:
+		if ip == nil {
+			return nil
+		}
+		return ip.String()
+	case net.IPNet:
+		return ip.String()
+	case *net.IPNet:
+		if ip == nil {
+			return nil
+		}
+		return ip.String()
+	}
+	return nil
+}
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// nilValuerPointer returns true if v is a nil pointer to a type whose Value
+// method has a value receiver. Like database/sql, these are bound as NULL
+// rather than calling Value, which would panic. Value methods with a pointer
+// receiver are still called, since they may handle nil themselves.
+func nilValuerPointer(v any) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Pointer && rv.IsNil() && rv.Type().Elem().Implements(valuerType)
+}
+
+// isNilPointer returns true if v is a nil pointer wrapped in an interface.
+func isNilPointer(v any) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Pointer && rv.IsNil()
+}
+
+// quoteString returns s as an ANSI string literal, with any single quotes
+// escaped by doubling them. Backslashes are left as is.
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -1,7 +1,17 @@
 package bqb
 
 import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"math"
+	"math/big"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func Test_dialectReplace_unknown_dialect(t *testing.T) {
@@ -19,3 +29,630 @@ func Test_dialectReplace_unknown_dialect(t *testing.T) {
 		t.Error("unknown dialect should not return an error")
 	}
 }
+
+func Test_dialectReplace_sql(t *testing.T) {
+	q := New("SELECT * FROM t WHERE a = ? AND b IN (?)", 1, []string{"x", "y"}).Limit(2)
+
+	sql, params, err := q.Sql(SQL)
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "SELECT * FROM t WHERE a = ? AND b IN (?,?) LIMIT 2"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{1, "x", "y"}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	sql2, _, _ := q.ToSql()
+	if sql2 != sql {
+		t.Errorf("got: %q from ToSql, want: %q", sql2, sql)
+	}
+}
+
+func TestRegisterDialect(t *testing.T) {
+	const percent Dialect = "percent"
+	RegisterDialect(percent, func(sql string, params []any) (string, error) {
+		for i := range params {
+			sql = strings.Replace(sql, ParamPlaceholder, "%"+strconv.Itoa(i+1), 1)
+		}
+		return sql, nil
+	})
+	defer RegisterDialect(percent, nil)
+
+	sql, params, err := New("a = ? AND b IN (?)", 1, []int{2, 3}).Sql(percent)
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+
+	want := "a = %1 AND b IN (%2,%3)"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	if len(params) != 3 {
+		t.Errorf("expected three params, got: %v", params)
+	}
+
+	RegisterDialect(percent, nil)
+	sql, _, _ = New("a = ?", 1).Sql(percent)
+	if sql != "a = "+paramPh {
+		t.Errorf("unregistered dialect should not replace params: %q", sql)
+	}
+}
+
+func TestRegisterDialectError(t *testing.T) {
+	const failing Dialect = "failing"
+	RegisterDialect(failing, func(sql string, params []any) (string, error) {
+		return "", errors.New("failing dialect")
+	})
+	defer RegisterDialect(failing, nil)
+
+	_, _, err := New("a = ?", 1).Sql(failing)
+	if err == nil || err.Error() != "failing dialect" {
+		t.Errorf("expected dialect error, got: %v", err)
+	}
+}
+
+type pgTestDriver struct{}
+
+func (*pgTestDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("not implemented")
+}
+
+type sqliteTestDriver struct{}
+
+func (*sqliteTestDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("not implemented")
+}
+
+type unknownTestDriver struct{}
+
+func (*unknownTestDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("not implemented")
+}
+
+func init() {
+	sql.Register("postgres", &pgTestDriver{})
+	sql.Register("sqlite3", &sqliteTestDriver{})
+	sql.Register("bqb_unknown", &unknownTestDriver{})
+}
+
+func TestDialectForDB(t *testing.T) {
+	tests := map[string]Dialect{
+		"postgres": PGSQL,
+		"sqlite3":  SQLITE,
+	}
+	for name, want := range tests {
+		db, err := sql.Open(name, "")
+		if err != nil {
+			t.Fatalf("failed to open %v: %v", name, err)
+		}
+		got, err := DialectForDB(db)
+		if err != nil {
+			t.Errorf("got error for %v: %v", name, err)
+		}
+		if got != want {
+			t.Errorf("got: %q, want: %q", got, want)
+		}
+		_ = db.Close()
+	}
+
+	db, _ := sql.Open("bqb_unknown", "")
+	defer db.Close()
+	if _, err := DialectForDB(db); err == nil {
+		t.Errorf("expected error for unknown driver")
+	}
+
+	if _, err := DialectForDB(nil); err == nil {
+		t.Errorf("expected error for nil DB")
+	}
+}
+
+func Test_paramToRaw_quotes(t *testing.T) {
+	tests := map[string]string{
+		"O'Brien":          `'O''Brien'`,
+		`back\slash`:       `'back\slash'`,
+		"'; DROP TABLE x;": `'''; DROP TABLE x;'`,
+		"it's 'quoted'":    `'it''s ''quoted'''`,
+	}
+	for in, want := range tests {
+		got, err := paramToRaw(in)
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		if got != want {
+			t.Errorf("got: %s, want: %s", got, want)
+		}
+
+		got, _ = paramToRaw(&in)
+		if got != want {
+			t.Errorf("got: %s, want: %s", got, want)
+		}
+	}
+
+	sql, _ := New("name = ?", "O'Brien").ToRaw()
+	if sql != "name = 'O''Brien'" {
+		t.Errorf("got unexpected sql: %s", sql)
+	}
+}
+
+func Test_paramToRaw_time(t *testing.T) {
+	var zero time.Time
+	normal := time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC)
+	var nilTime *time.Time
+
+	sql, err := New("? ? ? ?", zero, normal, &normal, nilTime).ToRaw()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+
+	want := "'0001-01-01 00:00:00' '2023-04-05 06:07:08' '2023-04-05 06:07:08' NULL"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	defer func(format string) { RawTimeFormat = format }(RawTimeFormat)
+	RawTimeFormat = time.RFC3339
+	sql, _ = New("?", normal).ToRaw()
+	want = "'2023-04-05T06:07:08Z'"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+}
+
+func Test_paramToRaw_bytes(t *testing.T) {
+	var nilBytes []byte
+	sql, err := New("? ?", []byte{0xde, 0xad, 0xbe, 0xef}, nilBytes).ToRaw()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+
+	want := `'\xdeadbeef' NULL`
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+}
+
+func Test_paramToRaw_pointers(t *testing.T) {
+	i64 := int64(64)
+	f64 := 1.5
+	b := true
+	var nilI64 *int64
+	var nilF64 *float64
+	var nilB *bool
+
+	sql, err := New("? ? ? ? ? ?", &i64, nilI64, &f64, nilF64, &b, nilB).ToRaw()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+
+	want := "64 NULL 1.5 NULL true NULL"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+}
+
+func Test_paramToRaw_uint(t *testing.T) {
+	u := uint(7)
+	var nilU *uint
+
+	sql, err := New("? ? ? ? ?", uint(42), uint8(8), uint64(64), &u, nilU).ToRaw()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+
+	want := "42 8 64 7 NULL"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+}
+
+func Test_paramToRaw_float(t *testing.T) {
+	sql, err := New("? ? ? ? ?", 1e6, 1e21, 0.000001, float32(2.5), -12.125).ToRaw()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+
+	want := "1000000 1000000000000000000000 0.000001 2.5 -12.125"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	for _, f := range []float64{math.Inf(1), math.Inf(-1), math.NaN()} {
+		_, err = New("?", f).ToRaw()
+		if err == nil {
+			t.Errorf("expected an error for %v", f)
+		}
+	}
+}
+
+func TestNetIP(t *testing.T) {
+	v4 := net.ParseIP("192.168.0.1")
+	v6 := net.ParseIP("2001:db8::1")
+	_, cidr, _ := net.ParseCIDR("10.0.0.0/8")
+	var nilIP net.IP
+
+	q := New("? ? ? ? ?", v4, v6, cidr, *cidr, nilIP)
+	sql, params, err := q.ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	if sql != "$1 $2 $3 $4 $5" {
+		t.Errorf("got: %q", sql)
+	}
+	want := []any{"192.168.0.1", "2001:db8::1", "10.0.0.0/8", "10.0.0.0/8", nil}
+	if !reflect.DeepEqual(params, want) {
+		t.Errorf("got params: %v, want: %v", params, want)
+	}
+
+	sql, err = q.ToRaw()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	wantRaw := "'192.168.0.1' '2001:db8::1' '10.0.0.0/8' '10.0.0.0/8' NULL"
+	if sql != wantRaw {
+		t.Errorf("got: %q, want: %q", sql, wantRaw)
+	}
+}
+
+func TestBigNumbers(t *testing.T) {
+	i, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	f, _ := new(big.Float).SetPrec(200).SetString("-98765432109876543210.125")
+	var nilInt *big.Int
+
+	q := New("? ? ? ? (?)", "7", i, f, nilInt, New("? ?", "8", i))
+	sql, params, err := q.ToPgsql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	if sql != "$1 $2 $3 $4 ($5 $6)" {
+		t.Errorf("got: %q", sql)
+	}
+	want := []any{"7", "123456789012345678901234567890", "-98765432109876543210.125", nil,
+		"8", "123456789012345678901234567890"}
+	if !reflect.DeepEqual(params, want) {
+		t.Errorf("got params: %v, want: %v", params, want)
+	}
+
+	sql, err = q.ToRaw()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	wantRaw := "'7' 123456789012345678901234567890 -98765432109876543210.125 NULL " +
+		"('8' 123456789012345678901234567890)"
+	if sql != wantRaw {
+		t.Errorf("got: %q, want: %q", sql, wantRaw)
+	}
+
+	_, _, err = New("?", new(big.Float).SetInf(false)).ToPgsql()
+	if err == nil {
+		t.Error("expected an error for +Inf")
+	}
+}
+
+type color int
+
+func (c *color) String() string {
+	if *c == 0 {
+		return "red"
+	}
+	return "it's blue"
+}
+
+func TestStringer(t *testing.T) {
+	red := color(0)
+	blue := color(1)
+	var nilColor *color
+
+	q := New("a = ? AND b = ? AND c = ?", &red, &blue, nilColor)
+	sql, params, err := q.ToSql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+
+	want := "a = ? AND b = ? AND c = ?"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	if len(params) != 3 || params[0] != "red" || params[1] != "it's blue" || params[2] != nil {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	sql, err = q.ToRaw()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want = "a = 'red' AND b = 'it''s blue' AND c = NULL"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	raw, _ := paramToRaw(&blue)
+	if raw != "'it''s blue'" {
+		t.Errorf("got unexpected raw value: %v", raw)
+	}
+	raw, _ = paramToRaw(nilColor)
+	if raw != "NULL" {
+		t.Errorf("got unexpected raw value: %v", raw)
+	}
+
+	now := time.Now()
+	_, params, _ = New("?", now).ToSql()
+	if params[0] != now {
+		t.Errorf("time.Time should not be converted to a string: %v", params[0])
+	}
+}
+
+func Test_reservedPlaceholders(t *testing.T) {
+	q := New("a = ? AND b = ?", paramPh, 2)
+	sql, params, err := q.ToSql()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	if sql != "a = ? AND b = ?" || params[0] != paramPh || params[1] != 2 {
+		t.Errorf("got unexpected sql: %q, params: %v", sql, params)
+	}
+
+	sql, err = q.ToRaw()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "a = '" + paramPh + "' AND b = 2"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	sql, _ = New("a = ? AND b = ?", escapePh, "c").ToRaw()
+	want = "a = '" + escapePh + "' AND b = 'c'"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+
+	for _, bad := range []*Query{
+		New("a = " + paramPh),
+		New("a = " + escapePh),
+		New("a = ?", Embedded(paramPh)),
+		New("a = ?", embedder{escapePh}),
+	} {
+		_, _, err = bad.ToSql()
+		if err == nil || !strings.Contains(err.Error(), "reserved placeholder") {
+			t.Errorf("expected reserved placeholder error, got: %v", err)
+		}
+	}
+}
+
+func Test_replacePlaceholders(t *testing.T) {
+	tests := []struct {
+		sql      string
+		collapse bool
+		want     string
+	}{
+		{"", true, ""},
+		{"no params", true, "no params"},
+		{paramPh + paramPh, true, "$1$2"},
+		{"a ?? " + paramPh + " ??? " + paramPh + "??", true, "a ? $1 ?? $2?"},
+		{"a ?? " + paramPh, false, "a ?? $1"},
+	}
+	for _, tt := range tests {
+		got, err := replacePlaceholders(tt.sql, tt.collapse, numbered("$"))
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		if got != tt.want {
+			t.Errorf("got: %q, want: %q", got, tt.want)
+		}
+	}
+
+	_, err := dialectReplace(RAW, paramPh+paramPh, []any{1})
+	if err == nil {
+		t.Errorf("expected error for missing raw parameter")
+	}
+}
+
+func TestRebind(t *testing.T) {
+	const in = "SELECT * FROM t WHERE a = ? AND b ?? 'k' AND c IN (?,?)"
+	tests := map[Dialect]string{
+		// sqlx.Rebind(sqlx.DOLLAR, ...) produces $N
+		PGSQL: "SELECT * FROM t WHERE a = $1 AND b ? 'k' AND c IN ($2,$3)",
+		// sqlx.Rebind(sqlx.QUESTION, ...) leaves the query as is
+		MYSQL:  in,
+		MSSQL:  "SELECT * FROM t WHERE a = @p1 AND b ? 'k' AND c IN (@p2,@p3)",
+		ORACLE: "SELECT * FROM t WHERE a = :1 AND b ? 'k' AND c IN (:2,:3)",
+		RAW:    in,
+	}
+	for dialect, want := range tests {
+		if got := Rebind(dialect, in); got != want {
+			t.Errorf("%v got: %q, want: %q", dialect, got, want)
+		}
+	}
+
+	sql, _, _ := New("a = ? AND b IN (?)", 1, []int{2, 3}).ToSql()
+	pg, _, _ := New("a = ? AND b IN (?)", 1, []int{2, 3}).ToPgsql()
+	if got := Rebind(PGSQL, sql); got != pg {
+		t.Errorf("got: %q, want: %q", got, pg)
+	}
+
+	const failing Dialect = "rebind_failing"
+	RegisterDialect(failing, func(string, []any) (string, error) {
+		return "", errors.New("failing")
+	})
+	defer RegisterDialect(failing, nil)
+	if got := Rebind(failing, in); got != in {
+		t.Errorf("got: %q, want: %q", got, in)
+	}
+
+	if got := Rebind(Dialect("unknown"), in); got != in {
+		t.Errorf("got: %q, want: %q", got, in)
+	}
+}
+
+func TestIdentifier(t *testing.T) {
+	q := New("SELECT ? FROM users ORDER BY ? DESC", Identifier("u.name"), Identifier("created_at"))
+
+	tests := []struct {
+		dialect Dialect
+		want    string
+	}{
+		{PGSQL, `SELECT "u"."name" FROM users ORDER BY "created_at" DESC`},
+		{MYSQL, "SELECT `u`.`name` FROM users ORDER BY `created_at` DESC"},
+		{MSSQL, "SELECT [u].[name] FROM users ORDER BY [created_at] DESC"},
+	}
+	for _, tt := range tests {
+		sql, params, err := q.Sql(tt.dialect)
+		if err != nil {
+			t.Errorf("got error: %v", err)
+		}
+		if sql != tt.want {
+			t.Errorf("got: %q, want: %q", sql, tt.want)
+		}
+		if len(params) != 0 {
+			t.Errorf("got unexpected params: %v", params)
+		}
+	}
+
+	if _, _, err := q.ToSql(); err == nil {
+		t.Error("expected an error for an Identifier with the generic SQL dialect")
+	}
+	if _, err := q.ToRaw(); err == nil {
+		t.Error("expected an error for an Identifier with the RAW dialect")
+	}
+
+	for _, name := range []string{`name"; DROP TABLE users; --`, "na`me", "", "a..b", "1a", "{{xX_IDENT_a_Xx}}"} {
+		_, _, err := New("ORDER BY ?", Identifier(name)).ToPgsql()
+		if err == nil {
+			t.Errorf("expected an error for identifier %q", name)
+		}
+	}
+}
+
+func Test_dialectReplace_clickhouse(t *testing.T) {
+	q := New("SELECT * FROM events WHERE tags ?? 'a' AND id IN (?) AND day = ?", []int{1, 2}, "2023-01-01")
+
+	sql, params, err := q.Sql(CLICKHOUSE)
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "SELECT * FROM events WHERE tags ? 'a' AND id IN (?,?) AND day = ?"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{1, 2, "2023-01-01"}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+}
+
+func Test_dialectReplace_bigquery(t *testing.T) {
+	q := New("SELECT * FROM ? WHERE a = ? AND b ?? 'k' AND c = ?", Identifier("events"), 1, "x")
+
+	sql, params, err := q.Sql(BIGQUERY)
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "SELECT * FROM `events` WHERE a = @p1 AND b ? 'k' AND c = @p2"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{1, "x"}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+}
+
+func Test_dialectReplace_duckdb(t *testing.T) {
+	q := New("SELECT * FROM t WHERE a = ? AND tags ?? 'k' AND b = ?", 1, "it's")
+
+	sql, params, err := q.Sql(DUCKDB)
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "SELECT * FROM t WHERE a = $1 AND tags ? 'k' AND b = $2"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{1, "it's"}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	sql, err = q.ToRaw()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want = "SELECT * FROM t WHERE a = 1 AND tags ?? 'k' AND b = 'it''s'"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+}
+
+func Test_dialectReplace_cockroach(t *testing.T) {
+	q := New("UPDATE users SET seen = NOW() WHERE ? AND tags ?? 'k' AND id = ?", ILike(COCKROACH, "name", "a%"), 7).
+		Returning(COCKROACH, "id")
+
+	sql, params, err := q.Sql(COCKROACH)
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "UPDATE users SET seen = NOW() WHERE name ILIKE $1 AND tags ? 'k' AND id = $2 RETURNING \"id\""
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{"a%", 7}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	pgSql, _, _ := q.ToPgsql()
+	if sql != pgSql {
+		t.Errorf("got: %q, want the postgres sql: %q", sql, pgSql)
+	}
+}
+
+func Test_dialectReplace_snowflake(t *testing.T) {
+	q := New("SELECT * FROM t WHERE a IN (?) AND b ?? 'k' AND c = ?", []int{1, 2}, "it's")
+
+	sql, params, err := q.Sql(SNOWFLAKE)
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "SELECT * FROM t WHERE a IN (?,?) AND b ? 'k' AND c = ?"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{1, 2, "it's"}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	sql, err = q.ToRaw()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want = "SELECT * FROM t WHERE a IN (1,2) AND b ?? 'k' AND c = 'it''s'"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+}
+
+func Test_dialectReplace_trino(t *testing.T) {
+	q := New("SELECT * FROM t WHERE a IN (?) AND b ?? 'k' AND c > ?", []string{"x", "y"}, 1e7)
+
+	sql, params, err := q.Sql(TRINO)
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want := "SELECT * FROM t WHERE a IN (?,?) AND b ? 'k' AND c > ?"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+	if !reflect.DeepEqual(params, []any{"x", "y", 1e7}) {
+		t.Errorf("got unexpected params: %v", params)
+	}
+
+	sql, err = q.ToRaw()
+	if err != nil {
+		t.Errorf("got error: %v", err)
+	}
+	want = "SELECT * FROM t WHERE a IN ('x','y') AND b ?? 'k' AND c > 10000000"
+	if sql != want {
+		t.Errorf("got: %q, want: %q", sql, want)
+	}
+}